@@ -0,0 +1,151 @@
+package apikey
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// ScopeRead allows only reading requests.
+	ScopeRead = "read"
+	// ScopeSubmit additionally allows submitting, activating and testing prompts.
+	ScopeSubmit = "submit"
+)
+
+var Scopes = []string{ScopeRead, ScopeSubmit}
+
+// Prefix tells API keys apart from PocketBase auth tokens in the
+// Authorization header.
+const Prefix = "aib_"
+
+const (
+	keyLength = 40
+	// number of key characters stored in plain text to recognize the key
+	displayLength = 8
+	// last_used is updated at most once in this interval
+	lastUsedInterval = time.Minute
+	maxKeysPerUser   = 20
+)
+
+// routes writing data which can be called with a submit key
+var submitRoutes = []string{
+	"POST /prompt",
+	"POST /prompt/{id}",
+	"POST /prompt/{id}/activate",
+	"POST /prompt/{id}/sandbox",
+	"POST /prompt/{id}/message",
+	"POST /battle/{id}/improve",
+	"POST /api/v1/prompts",
+	"POST /api/v1/prompts/{id}/activate",
+	"POST /api/v1/prompts/{id}/messages",
+}
+
+var ErrInvalidKey = errors.New("invalid API key")
+
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create mints a new key for the user. The plain key is returned only here,
+// the record keeps its hash.
+func Create(app core.App, userID string, name string, scope string) (string, *core.Record, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return "", nil, errors.New("key name must be 1-100 characters long")
+	}
+	if !slices.Contains(Scopes, scope) {
+		return "", nil, fmt.Errorf("unknown scope %s", scope)
+	}
+	count, err := app.CountRecords("api_key", dbx.HashExp{"user": userID})
+	if err != nil {
+		return "", nil, err
+	}
+	if count >= maxKeysPerUser {
+		return "", nil, fmt.Errorf("at most %d keys are allowed", maxKeysPerUser)
+	}
+
+	collection, err := app.FindCollectionByNameOrId("api_key")
+	if err != nil {
+		return "", nil, err
+	}
+	key := Prefix + security.RandomString(keyLength)
+	record := core.NewRecord(collection)
+	record.Set("user", userID)
+	record.Set("name", name)
+	record.Set("scope", scope)
+	record.Set("key_hash", Hash(key))
+	record.Set("prefix", key[:len(Prefix)+displayLength])
+	if err := app.Save(record); err != nil {
+		return "", nil, fmt.Errorf("error saving API key: %w", err)
+	}
+	return key, record, nil
+}
+
+// Revoke deletes the key, only the owner can revoke it.
+func Revoke(app core.App, userID string, id string) error {
+	record, err := app.FindFirstRecordByFilter(
+		"api_key", "id = {:id} && user = {:user}", dbx.Params{"id": id, "user": userID},
+	)
+	if err != nil {
+		return err
+	}
+	return app.Delete(record)
+}
+
+func List(app core.App, userID string) ([]*core.Record, error) {
+	return app.FindRecordsByFilter(
+		"api_key", "user = {:user}", "-created", 0, 0, dbx.Params{"user": userID},
+	)
+}
+
+// Authenticate returns the key owner and the key record.
+func Authenticate(app core.App, key string) (*core.Record, *core.Record, error) {
+	record, err := app.FindFirstRecordByData("api_key", "key_hash", Hash(key))
+	if err != nil {
+		return nil, nil, ErrInvalidKey
+	}
+	user, err := app.FindRecordById("users", record.GetString("user"))
+	if err != nil {
+		return nil, nil, ErrInvalidKey
+	}
+
+	if time.Since(record.GetDateTime("last_used").Time()) > lastUsedInterval {
+		record.Set("last_used", types.NowDateTime())
+		if err := app.Save(record); err != nil {
+			app.Logger().Warn("error updating API key usage", "error", err)
+		}
+	}
+	return user, record, nil
+}
+
+// Allows checks whether the key scope permits the request, pattern is the
+// matched route pattern like "POST /prompt/{id}".
+func Allows(scope string, method string, pattern string) bool {
+	if method == http.MethodGet || method == http.MethodHead {
+		return true
+	}
+	return scope == ScopeSubmit && slices.Contains(submitRoutes, pattern)
+}
+
+// FromHeader returns the API key from the Authorization header or an empty
+// string when the header holds something else.
+func FromHeader(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	key := strings.TrimPrefix(header, "Bearer ")
+	if !strings.HasPrefix(key, Prefix) {
+		return ""
+	}
+	return key
+}
@@ -0,0 +1,50 @@
+package apikey
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		scope   string
+		method  string
+		pattern string
+		allowed bool
+	}{
+		{ScopeRead, http.MethodGet, "GET /api/v1/prompts", true},
+		{ScopeRead, http.MethodHead, "HEAD /battle/{id}/replay.json.gz", true},
+		{ScopeSubmit, http.MethodGet, "GET /api/v1/battles/{id}", true},
+		{ScopeRead, http.MethodPost, "POST /api/v1/prompts", false},
+		{ScopeRead, http.MethodPost, "POST /prompt/{id}/activate", false},
+		{ScopeSubmit, http.MethodPost, "POST /prompt", true},
+		{ScopeSubmit, http.MethodPost, "POST /prompt/{id}", true},
+		{ScopeSubmit, http.MethodPost, "POST /prompt/{id}/activate", true},
+		{ScopeSubmit, http.MethodPost, "POST /prompt/{id}/sandbox", true},
+		{ScopeSubmit, http.MethodPost, "POST /prompt/{id}/message", true},
+		{ScopeSubmit, http.MethodPost, "POST /battle/{id}/improve", true},
+		{ScopeSubmit, http.MethodPost, "POST /api/v1/prompts", true},
+		{ScopeSubmit, http.MethodPost, "POST /api/v1/prompts/{id}/activate", true},
+		{ScopeSubmit, http.MethodPost, "POST /api/v1/prompts/{id}/messages", true},
+		// keys can't manage keys, battles or tournaments
+		{ScopeSubmit, http.MethodPost, "POST /keys", false},
+		{ScopeSubmit, http.MethodPost, "POST /keys/{id}/revoke", false},
+		{ScopeSubmit, http.MethodPost, "POST /battle/run", false},
+		{ScopeSubmit, http.MethodPost, "POST /tournament", false},
+		{ScopeSubmit, http.MethodPost, "POST /unknown/{id}", false},
+		// the pattern must match exactly
+		{ScopeSubmit, http.MethodPost, "POST /prompt/{id}/", false},
+		{ScopeSubmit, http.MethodPost, "/prompt/{id}", false},
+		{ScopeSubmit, http.MethodDelete, "DELETE /prompt/{id}", false},
+		{"admin", http.MethodPost, "POST /prompt", false},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.scope+" "+test.pattern, func(t *testing.T) {
+				assert.Equal(t, test.allowed, Allows(test.scope, test.method, test.pattern))
+			},
+		)
+	}
+}
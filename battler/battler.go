@@ -2,20 +2,24 @@ package battler
 
 import (
 	"aibattle/game/world"
+	"aibattle/season"
 	"bytes"
 	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math"
+	"strings"
 
 	"github.com/samber/lo"
 
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
 )
 
 func RunBattle(app *pocketbase.PocketBase, nextPromptID string) error {
@@ -23,15 +27,26 @@ func RunBattle(app *pocketbase.PocketBase, nextPromptID string) error {
 	if prompt2Err != nil {
 		return prompt2Err
 	}
+	_, err := PlayBattle(app, prompt1, prompt2, true)
+	return err
+}
 
-	user1Score, user2Score, scoreErr := getScores(
-		app, prompt1.GetString("user"), prompt2.GetString("user"),
-	)
-	if scoreErr != nil {
-		return scoreErr
+// PlayBattle runs the battle between two prompts and saves its results.
+// Unrated battles don't change user scores and prompt ratings.
+// Returns the battle result of the first prompt.
+func PlayBattle(
+	app *pocketbase.PocketBase, prompt1 *core.Record, prompt2 *core.Record, rated bool,
+) (*core.Record, error) {
+	var user1Score, user2Score *core.Record
+	if rated {
+		var scoreErr error
+		user1Score, user2Score, scoreErr = getScores(
+			app, prompt1.GetString("user"), prompt2.GetString("user"),
+		)
+		if scoreErr != nil {
+			return nil, scoreErr
+		}
 	}
-	oldScore1 := user1Score.GetFloat("score")
-	oldScore2 := user2Score.GetFloat("score")
 
 	// Run battle
 	result, err := GetBattleResult(
@@ -40,35 +55,35 @@ func RunBattle(app *pocketbase.PocketBase, nextPromptID string) error {
 		prompt2,
 	)
 	if err != nil {
-		return fmt.Errorf("error running battle: %w", err)
+		return nil, fmt.Errorf("error running battle: %w", err)
 	}
 
-	err = updateUserScores(app, user1Score, user2Score, result.Winner)
-	if err != nil {
-		return fmt.Errorf("error updating scores: %w", err)
+	scoreChange1, scoreChange2 := 0.0, 0.0
+	if rated {
+		oldScore1 := user1Score.GetFloat("score")
+		oldScore2 := user2Score.GetFloat("score")
+		err = updateUserScores(app, user1Score, user2Score, prompt1.Id, prompt2.Id, result.Winner)
+		if err != nil {
+			return nil, fmt.Errorf("error updating scores: %w", err)
+		}
+		scoreChange1 = user1Score.GetFloat("score") - oldScore1
+		scoreChange2 = user2Score.GetFloat("score") - oldScore2
 	}
 
-	battle, batErr := saveBattle(app, result)
+	battle, batErr := SaveBattle(app, result, prompt1, prompt2)
 	if batErr != nil {
-		return batErr
+		return nil, batErr
 	}
 
-	resErr := saveBattleResults(
-		app, result, user1Score, oldScore1, prompt1, prompt2, battle, user2Score, oldScore2,
+	return saveBattleResults(
+		app, result, prompt1, prompt2, battle, scoreChange1, scoreChange2, rated,
 	)
-	if resErr != nil {
-		return resErr
-	}
-
-	return nil
-
 }
 
 func saveBattleResults(
-	app *pocketbase.PocketBase, result world.Result, user1Score *core.Record, oldScore1 float64,
-	prompt1 *core.Record, prompt2 *core.Record, battle *core.Record, user2Score *core.Record,
-	oldScore2 float64,
-) error {
+	app *pocketbase.PocketBase, result world.Result, prompt1 *core.Record, prompt2 *core.Record,
+	battle *core.Record, scoreChange1 float64, scoreChange2 float64, rated bool,
+) (*core.Record, error) {
 	user1Res := ""
 	user2Res := ""
 	switch result.Winner {
@@ -85,30 +100,37 @@ func saveBattleResults(
 	// Create battle result records for both players
 	battleResultColl, findErr := app.FindCollectionByNameOrId("battle_result")
 	if findErr != nil {
-		return fmt.Errorf("error finding battle collection: %w", findErr)
+		return nil, fmt.Errorf("error finding battle collection: %w", findErr)
 	}
-	scoreChange := user1Score.GetFloat("score") - oldScore1
 	result1 := createBattleResult(
-		prompt1, prompt2.GetString("user"), battle.Id, scoreChange,
-		battleResultColl, "teamA", user1Res,
+		prompt1, prompt2.GetString("user"), battle.Id, scoreChange1,
+		battleResultColl, "teamA", user1Res, rated,
 	)
 	if res1Err := app.Save(result1); res1Err != nil {
-		return fmt.Errorf("error saving battle result 1: %w", res1Err)
+		return nil, fmt.Errorf("error saving battle result 1: %w", res1Err)
+	}
+
+	// sparring between prompts of the same user is shown only once
+	if prompt1.GetString("user") == prompt2.GetString("user") {
+		return result1, nil
 	}
 
-	scoreChange2 := user2Score.GetFloat("score") - oldScore2
 	result2 := createBattleResult(
 		prompt2, prompt1.GetString("user"), battle.Id, scoreChange2,
-		battleResultColl, "teamB", user2Res,
+		battleResultColl, "teamB", user2Res, rated,
 	)
 	if res2Err := app.Save(result2); res2Err != nil {
-		return fmt.Errorf("error saving battle result 2: %w", res2Err)
+		return nil, fmt.Errorf("error saving battle result 2: %w", res2Err)
 	}
-	return nil
+	return result1, nil
 }
 
-func saveBattle(app *pocketbase.PocketBase, result world.Result) (*core.Record, error) {
-	compressedRes, zipErr := MarshalGzip(result)
+const ReplayFileName = "replay.gz"
+
+func SaveBattle(
+	app *pocketbase.PocketBase, result world.Result, promptA *core.Record, promptB *core.Record,
+) (*core.Record, error) {
+	compressedRes, zipErr := EncodeBattle(result)
 	if zipErr != nil {
 		return nil, fmt.Errorf("error comporessing result: %w", zipErr)
 	}
@@ -118,8 +140,15 @@ func saveBattle(app *pocketbase.PocketBase, result world.Result) (*core.Record,
 	if colErr != nil {
 		return nil, fmt.Errorf("error finding battle collection: %w", colErr)
 	}
+	replay, fileErr := filesystem.NewFileFromBytes([]byte(compressedRes), ReplayFileName)
+	if fileErr != nil {
+		return nil, fileErr
+	}
 	battle := core.NewRecord(collection)
-	battle.Set("output", compressedRes)
+	battle.Set("replay", replay)
+	battle.Set("prompt_a", promptA.Id)
+	battle.Set("prompt_b", promptB.Id)
+	battle.Set("code_hash", CodeHash(promptA.GetString("output"), promptB.GetString("output")))
 	if batErr := app.Save(battle); batErr != nil {
 		return nil, fmt.Errorf("error saving battle: %w", batErr)
 	}
@@ -127,12 +156,22 @@ func saveBattle(app *pocketbase.PocketBase, result world.Result) (*core.Record,
 	return battle, nil
 }
 
-func getNextPrompt(
-	app *pocketbase.PocketBase, nextPromptID string,
-) (*core.Record, *core.Record, error) {
+// getNextPrompt picks two active prompts, the given prompt is always one of
+// them. Users have a score per season, only the current one is joined so every
+// prompt comes once.
+func getNextPrompt(app core.App, nextPromptID string) (*core.Record, *core.Record, error) {
+	seasonID, err := season.CurrentID(app)
+	if err != nil {
+		return nil, nil, err
+	}
 	var records []*core.Record
-	err := app.RecordQuery("prompt").
-		Join("LEFT JOIN", "score", dbx.NewExp("score.user = prompt.user")).
+	err = app.RecordQuery("prompt").
+		Join(
+			"LEFT JOIN", "score", dbx.NewExp(
+				"score.user = prompt.user AND score.season = {:season}",
+				dbx.Params{"season": seasonID},
+			),
+		).
 		AndWhere(dbx.HashExp{"prompt.active": true}).
 		OrWhere(dbx.HashExp{"prompt.id": nextPromptID}).
 		OrderBy("score.updated ASC").
@@ -163,7 +202,7 @@ func getNextPrompt(
 
 func updateUserScores(
 	app *pocketbase.PocketBase, user1Score *core.Record, user2Score *core.Record,
-	winnerTeam int,
+	prompt1ID string, prompt2ID string, winnerTeam int,
 ) error {
 	return app.RunInTransaction(
 		func(txApp core.App) error {
@@ -175,35 +214,57 @@ func updateUserScores(
 				"user 2 user id: %s score id: %s start score: %f\n", user2Score.GetString("user"),
 				user2Score.Id, user2Score.GetFloat("score"),
 			)
-			winner, looser := user1Score, user2Score
-			if winnerTeam != world.TeamA {
-				winner, looser = looser, winner
+			if err := updateRatings(txApp, user1Score, user2Score, "score", winnerTeam); err != nil {
+				return fmt.Errorf("error updating user scores: %w", err)
 			}
-			newScore1, newScore2 := getNewScores(
-				winner.GetFloat("score"), looser.GetFloat("score"), winnerTeam == world.Draw,
-			)
-			fmt.Printf(
-				"team %d won, winner %s score %f, looser %s score %f\n", winnerTeam, winner.Id,
-				newScore1, looser.Id, newScore2,
-			)
-			winner.Set("score", newScore1)
-			looser.Set("score", newScore2)
 
-			// Save both score updates
-			if err := txApp.Save(user1Score); err != nil {
-				return fmt.Errorf("error updating user1 score: %w", err)
+			// prompts are reloaded to not overwrite changes made while the battle was running
+			prompt1, err := txApp.FindRecordById("prompt", prompt1ID)
+			if err != nil {
+				return err
 			}
-			if err := txApp.Save(user2Score); err != nil {
-				return fmt.Errorf("error updating user2 score: %w", err)
+			prompt2, err := txApp.FindRecordById("prompt", prompt2ID)
+			if err != nil {
+				return err
+			}
+			if err := updateRatings(txApp, prompt1, prompt2, "rating", winnerTeam); err != nil {
+				return fmt.Errorf("error updating prompt ratings: %w", err)
 			}
 			return nil
 		},
 	)
 }
 
+func updateRatings(
+	txApp core.App, record1 *core.Record, record2 *core.Record, field string, winnerTeam int,
+) error {
+	winner, looser := record1, record2
+	if winnerTeam != world.TeamA {
+		winner, looser = looser, winner
+	}
+	newScore1, newScore2 := GetNewScores(
+		winner.GetFloat(field), looser.GetFloat(field), winnerTeam == world.Draw,
+	)
+	fmt.Printf(
+		"team %d won, winner %s %s %f, looser %s %s %f\n", winnerTeam, winner.Id, field,
+		newScore1, looser.Id, field, newScore2,
+	)
+	winner.Set(field, newScore1)
+	looser.Set(field, newScore2)
+
+	// Save both updates
+	if err := txApp.Save(record1); err != nil {
+		return err
+	}
+	if err := txApp.Save(record2); err != nil {
+		return err
+	}
+	return nil
+}
+
 func createBattleResult(
 	prompt *core.Record, opponentID string, battleID string, scoreChange float64,
-	collection *core.Collection, team string, res string,
+	collection *core.Collection, team string, res string, rated bool,
 ) *core.Record {
 	result := core.NewRecord(collection)
 	result.Set("user", prompt.GetString("user"))
@@ -213,34 +274,31 @@ func createBattleResult(
 	result.Set("score_change", scoreChange)
 	result.Set("team", team)
 	result.Set("result", res)
+	result.Set("rated", rated)
 	return result
 }
 
 func getScores(
 	app *pocketbase.PocketBase, user1 string, user2 string,
 ) (*core.Record, *core.Record, error) {
-	var scores []*core.Record
-	err := app.RecordQuery("score").
-		AndWhere(
-			dbx.HashExp{
-				"user": dbx.Or(
-					dbx.HashExp{"user": user1},
-					dbx.HashExp{"user": user2},
-				),
-			},
-		).All(&scores)
+	seasonID, err := season.CurrentID(app)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	user1Score, user2Score := scores[0], scores[1]
-	if user1Score.GetString("user") != user1 {
-		user1Score, user2Score = user2Score, user1Score
+	user1Score, err := season.FindOrCreateScore(app, user1, seasonID)
+	if err != nil {
+		return nil, nil, err
+	}
+	user2Score, err := season.FindOrCreateScore(app, user2, seasonID)
+	if err != nil {
+		return nil, nil, err
 	}
 	return user1Score, user2Score, nil
 }
 
-func getNewScores(winner float64, looser float64, draw bool) (float64, float64) {
+// GetNewScores returns the ELO ratings of the winner and the looser after the
+// game.
+func GetNewScores(winner float64, looser float64, draw bool) (float64, float64) {
 	// Calculate ELO rating changes
 	k := 32.0 // K-factor determines how much ratings can change
 
@@ -260,10 +318,11 @@ func getNewScores(winner float64, looser float64, draw bool) (float64, float64)
 	return newScore1, newScore2
 }
 
-func MarshalGzip(result world.Result) (string, error) {
-	data, err := json.Marshal(result)
+// EncodeBattle stores the result in the replay format compressed with gzip.
+func EncodeBattle(result world.Result) (string, error) {
+	data, err := world.EncodeReplay(result)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("error encoding replay: %w", err)
 	}
 	// Compress output
 	var b bytes.Buffer
@@ -276,3 +335,69 @@ func MarshalGzip(result world.Result) (string, error) {
 	}
 	return b.String(), nil
 }
+
+// DecodeBattle reads the stored battle output, battles stored before the
+// replay format contain the result as JSON.
+func DecodeBattle(compressed string) (world.Result, error) {
+	gzReader, err := gzip.NewReader(strings.NewReader(compressed))
+	if err != nil {
+		return world.Result{}, err
+	}
+	defer func(gzReader *gzip.Reader) {
+		err := gzReader.Close()
+		if err != nil {
+			log.Println(err)
+		}
+	}(gzReader)
+
+	decompressed, err := io.ReadAll(gzReader)
+	if err != nil {
+		return world.Result{}, err
+	}
+	if world.IsReplay(decompressed) {
+		return world.DecodeReplay(decompressed)
+	}
+	var result world.Result
+	if err := json.Unmarshal(decompressed, &result); err != nil {
+		return world.Result{}, fmt.Errorf("error decoding battle: %w", err)
+	}
+	return result, nil
+}
+
+// LoadBattle reads the replay file of the battle, older battles keep the
+// output in the record.
+func LoadBattle(app core.App, battle *core.Record) (world.Result, error) {
+	replay := battle.GetString("replay")
+	if replay == "" {
+		return DecodeBattle(battle.GetString("output"))
+	}
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return world.Result{}, err
+	}
+	defer fsys.Close()
+	reader, err := fsys.GetFile(battle.BaseFilesPath() + "/" + replay)
+	if err != nil {
+		return world.Result{}, fmt.Errorf("error opening replay: %w", err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return world.Result{}, fmt.Errorf("error reading replay: %w", err)
+	}
+	return DecodeBattle(string(data))
+}
+
+// LoadBattleJSON returns the battle result as JSON used by the battle viewer.
+func LoadBattleJSON(app core.App, battle *core.Record) (string, error) {
+	result, err := LoadBattle(app, battle)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,84 @@
+package battler
+
+import (
+	_ "aibattle/migrations"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	pbtests "github.com/pocketbase/pocketbase/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestApp(t *testing.T) *pbtests.TestApp {
+	app, err := pbtests.NewTestApp(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(app.Cleanup)
+	return app
+}
+
+func createRecord(
+	t *testing.T, app core.App, collection string, data map[string]any,
+) *core.Record {
+	c, err := app.FindCollectionByNameOrId(collection)
+	require.NoError(t, err)
+	record := core.NewRecord(c)
+	record.Load(data)
+	require.NoError(t, app.Save(record))
+	return record
+}
+
+func TestGetNextPrompt(t *testing.T) {
+	app := newTestApp(t)
+	var seasons []*core.Record
+	for _, start := range []string{"2025-01-01 00:00:00.000Z", "2025-06-01 00:00:00.000Z"} {
+		seasons = append(
+			seasons, createRecord(
+				t, app, "season", map[string]any{
+					"name": start, "start": start, "end": start, "started": true,
+				},
+			),
+		)
+	}
+	var prompts []*core.Record
+	for i, name := range []string{"alice", "bob"} {
+		user := createRecord(
+			t, app, "users", map[string]any{
+				"email": name + "@example.com", "password": "password123", "name": name,
+			},
+		)
+		// alice played both seasons, bob only the current one
+		for _, season := range seasons[i:] {
+			createRecord(
+				t, app, "score", map[string]any{"user": user.Id, "season": season.Id, "score": 1000},
+			)
+		}
+		prompts = append(
+			prompts, createRecord(
+				t, app, "prompt", map[string]any{"user": user.Id, "active": true, "text": name},
+			),
+		)
+	}
+
+	tests := []struct {
+		name         string
+		nextPromptID string
+	}{
+		{name: "random pair"},
+		{name: "with the next prompt", nextPromptID: prompts[0].Id},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				// the pair is shuffled
+				for range 20 {
+					prompt1, prompt2, err := getNextPrompt(app, test.nextPromptID)
+					require.NoError(t, err)
+					assert.ElementsMatch(
+						t, []string{prompts[0].Id, prompts[1].Id}, []string{prompt1.Id, prompt2.Id},
+					)
+				}
+			},
+		)
+	}
+}
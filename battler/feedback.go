@@ -0,0 +1,158 @@
+package battler
+
+import (
+	"aibattle/game/world"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// errors listed in the feedback, the rest are only counted
+const maxFeedbackErrors = 5
+
+// UnitLoss is a unit of the team killed in the battle.
+type UnitLoss struct {
+	ID   int    `json:"id"`
+	Type string `json:"type"`
+	Turn int    `json:"turn"`
+}
+
+// Feedback summarizes how one team played a battle.
+type Feedback struct {
+	Team          string     `json:"team"`
+	Winner        string     `json:"winner"`
+	Turns         int        `json:"turns"`
+	Actions       int        `json:"actions"`
+	FailedActions int        `json:"failed_actions"`
+	Errors        []string   `json:"errors"`
+	DamageTaken   int        `json:"damage_taken"`
+	DamageDealt   int        `json:"damage_dealt"`
+	UnitsLost     []UnitLoss `json:"units_lost"`
+	Units         int        `json:"units"`
+	EnemiesKilled int        `json:"enemies_killed"`
+	Enemies       int        `json:"enemies"`
+}
+
+// AnalyzeBattle collects failed actions, damage and unit deaths of the team
+// from the battle result.
+func AnalyzeBattle(result world.Result, team int) Feedback {
+	feedback := Feedback{
+		Team:   world.GetTeamName(team),
+		Winner: world.GetTeamName(result.Winner),
+	}
+	units := make(map[int]world.Unit, len(result.InitUnits))
+	for _, unit := range result.InitUnits {
+		units[unit.ID] = unit
+		if unit.Team == team {
+			feedback.Units++
+		} else {
+			feedback.Enemies++
+		}
+	}
+
+	var seen []string
+	for _, turn := range result.Turns {
+		feedback.Turns = max(feedback.Turns, turn.Turn+1)
+		actor := units[turn.UnitID]
+		if actor.Team == team {
+			feedback.Actions++
+			if len(turn.Errors) > 0 {
+				feedback.FailedActions++
+				for _, err := range turn.Errors {
+					// the same mistake is usually repeated every turn
+					if len(feedback.Errors) == maxFeedbackErrors || slices.Contains(seen, err) {
+						continue
+					}
+					seen = append(seen, err)
+					feedback.Errors = append(
+						feedback.Errors,
+						fmt.Sprintf("turn %d, %s %d: %s", turn.Turn, actor.Type, actor.ID, err),
+					)
+				}
+			}
+		}
+		for _, after := range turn.UnitsAfter {
+			before := units[after.ID]
+			if damage := before.HP - max(after.HP, 0); damage > 0 {
+				if after.Team == team {
+					feedback.DamageTaken += damage
+				} else if actor.Team == team {
+					feedback.DamageDealt += damage
+				}
+			}
+			if before.HP > 0 && after.HP <= 0 {
+				if after.Team == team {
+					feedback.UnitsLost = append(
+						feedback.UnitsLost, UnitLoss{ID: after.ID, Type: after.Type, Turn: turn.Turn},
+					)
+				} else {
+					feedback.EnemiesKilled++
+				}
+			}
+			units[after.ID] = after
+		}
+	}
+	return feedback
+}
+
+// LoadFeedback analyzes the battle for the team of the battle result.
+func LoadFeedback(app core.App, battleResult *core.Record) (Feedback, error) {
+	battle, err := app.FindRecordById("battle", battleResult.GetString("battle"))
+	if err != nil {
+		return Feedback{}, err
+	}
+	game, err := LoadBattle(app, battle)
+	if err != nil {
+		return Feedback{}, err
+	}
+	team := world.TeamA
+	if battleResult.GetString("team") != "teamA" {
+		team = world.TeamB
+	}
+	return AnalyzeBattle(game, team), nil
+}
+
+// Outcome is won, lost or draw for the team.
+func (f Feedback) Outcome() string {
+	switch f.Winner {
+	case f.Team:
+		return "won"
+	case world.GetTeamName(world.Draw):
+		return "draw"
+	default:
+		return "lost"
+	}
+}
+
+// String describes the feedback for the model.
+func (f Feedback) String() string {
+	var text strings.Builder
+	fmt.Fprintf(
+		&text, "The bot played as %s, the result is %s after %d turns.\n", f.Team, f.Outcome(),
+		f.Turns,
+	)
+	fmt.Fprintf(&text, "- %d of %d actions failed", f.FailedActions, f.Actions)
+	if len(f.Errors) > 0 {
+		text.WriteString(", for example:\n")
+		for _, err := range f.Errors {
+			text.WriteString("  - " + err + "\n")
+		}
+	} else {
+		text.WriteString(".\n")
+	}
+	fmt.Fprintf(&text, "- The team took %d damage and dealt %d.\n", f.DamageTaken, f.DamageDealt)
+	fmt.Fprintf(&text, "- %d of %d units were lost", len(f.UnitsLost), f.Units)
+	for i, loss := range f.UnitsLost {
+		if i == 0 {
+			text.WriteString(": ")
+		} else {
+			text.WriteString(", ")
+		}
+		fmt.Fprintf(&text, "%s %d on turn %d", loss.Type, loss.ID, loss.Turn)
+	}
+	text.WriteString(".\n")
+	fmt.Fprintf(&text, "- %d of %d enemy units were killed.\n", f.EnemiesKilled, f.Enemies)
+	return text.String()
+}
@@ -0,0 +1,156 @@
+package battler
+
+import (
+	"aibattle/game/world"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeBattle(t *testing.T) {
+	warriorA := world.Unit{ID: 1, Team: world.TeamA, Type: world.WARRIOR, HP: 100, MaxHP: 100}
+	healerA := world.Unit{ID: 2, Team: world.TeamA, Type: world.HEALER, HP: 50, MaxHP: 50}
+	warriorB := world.Unit{ID: 3, Team: world.TeamB, Type: world.WARRIOR, HP: 100, MaxHP: 100}
+	withHP := func(unit world.Unit, hp int) world.Unit {
+		unit.HP = hp
+		return unit
+	}
+
+	manyErrors := []world.ActionLog{
+		{Turn: 0, UnitID: 1, Errors: []string{"out of range", "out of range"}},
+		{Turn: 1, UnitID: 1, Errors: []string{"out of range", "blocked"}},
+		{Turn: 1, UnitID: 3, Errors: []string{"enemy error"}},
+	}
+	expectedErrors := []string{"turn 0, warrior 1: out of range", "turn 1, warrior 1: blocked"}
+	for i := range maxFeedbackErrors {
+		err := fmt.Sprintf("error %d", i)
+		manyErrors = append(manyErrors, world.ActionLog{Turn: 2 + i, UnitID: 1, Errors: []string{err}})
+		if len(expectedErrors) < maxFeedbackErrors {
+			expectedErrors = append(expectedErrors, fmt.Sprintf("turn %d, warrior 1: %s", 2+i, err))
+		}
+	}
+
+	tests := []struct {
+		name     string
+		result   world.Result
+		team     int
+		expected Feedback
+	}{
+		{
+			name: "damage taken and dealt",
+			result: world.Result{
+				Winner:    world.Draw,
+				InitUnits: []world.Unit{warriorA, healerA, warriorB},
+				Turns: []world.ActionLog{
+					{Turn: 0, UnitID: 1, UnitsAfter: []world.Unit{withHP(warriorB, 70)}},
+					{Turn: 0, UnitID: 3, UnitsAfter: []world.Unit{withHP(warriorA, 80)}},
+					{Turn: 1, UnitID: 1, UnitsAfter: []world.Unit{withHP(warriorB, 40)}},
+				},
+			},
+			team: world.TeamA,
+			expected: Feedback{
+				Team:        "TeamA",
+				Winner:      "Draw",
+				Turns:       2,
+				Actions:     2,
+				DamageTaken: 20,
+				DamageDealt: 60,
+				Units:       2,
+				Enemies:     1,
+			},
+		},
+		{
+			name: "heals are not counted",
+			result: world.Result{
+				Winner:    world.TeamA,
+				InitUnits: []world.Unit{warriorA, healerA, warriorB},
+				Turns: []world.ActionLog{
+					{Turn: 0, UnitID: 3, UnitsAfter: []world.Unit{withHP(warriorA, 70)}},
+					{Turn: 0, UnitID: 2, UnitsAfter: []world.Unit{withHP(warriorA, 100)}},
+					{Turn: 1, UnitID: 3, UnitsAfter: []world.Unit{withHP(warriorA, 90)}},
+				},
+			},
+			team: world.TeamA,
+			expected: Feedback{
+				Team:        "TeamA",
+				Winner:      "TeamA",
+				Turns:       2,
+				Actions:     1,
+				DamageTaken: 40,
+				Units:       2,
+				Enemies:     1,
+			},
+		},
+		{
+			name: "unit death",
+			result: world.Result{
+				Winner:    world.TeamB,
+				InitUnits: []world.Unit{warriorA, healerA, warriorB},
+				Turns: []world.ActionLog{
+					{Turn: 0, UnitID: 3, UnitsAfter: []world.Unit{withHP(healerA, 20)}},
+					// overkill only counts the remaining hit points
+					{Turn: 1, UnitID: 3, UnitsAfter: []world.Unit{withHP(healerA, -10)}},
+					{Turn: 2, UnitID: 3, UnitsAfter: []world.Unit{withHP(healerA, -10)}},
+				},
+			},
+			team: world.TeamA,
+			expected: Feedback{
+				Team:        "TeamA",
+				Winner:      "TeamB",
+				Turns:       3,
+				DamageTaken: 50,
+				UnitsLost:   []UnitLoss{{ID: 2, Type: world.HEALER, Turn: 1}},
+				Units:       2,
+				Enemies:     1,
+			},
+		},
+		{
+			name: "enemy killed",
+			result: world.Result{
+				Winner:    world.TeamA,
+				InitUnits: []world.Unit{warriorA, healerA, warriorB},
+				Turns: []world.ActionLog{
+					{Turn: 0, UnitID: 1, UnitsAfter: []world.Unit{withHP(warriorB, 0)}},
+				},
+			},
+			team: world.TeamA,
+			expected: Feedback{
+				Team:          "TeamA",
+				Winner:        "TeamA",
+				Turns:         1,
+				Actions:       1,
+				DamageDealt:   100,
+				Units:         2,
+				EnemiesKilled: 1,
+				Enemies:       1,
+			},
+		},
+		{
+			name: "errors are de-duplicated and capped",
+			result: world.Result{
+				Winner:    world.TeamB,
+				InitUnits: []world.Unit{warriorA, healerA, warriorB},
+				Turns:     manyErrors,
+			},
+			team: world.TeamA,
+			expected: Feedback{
+				Team:          "TeamA",
+				Winner:        "TeamB",
+				Turns:         2 + maxFeedbackErrors,
+				Actions:       2 + maxFeedbackErrors,
+				FailedActions: 2 + maxFeedbackErrors,
+				Errors:        expectedErrors,
+				Units:         2,
+				Enemies:       1,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				assert.Equal(t, test.expected, AnalyzeBattle(test.result, test.team))
+			},
+		)
+	}
+}
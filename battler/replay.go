@@ -0,0 +1,114 @@
+package battler
+
+import (
+	"aibattle/game/world"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	VerificationOK            = "ok"
+	VerificationPromptChanged = "prompt_changed"
+	VerificationMismatch      = "mismatch"
+	VerificationError         = "error"
+)
+
+// maximum number of differences kept for a verification
+const verificationDiffLimit = 10
+
+type Verification struct {
+	BattleID    string   `json:"battle_id"`
+	Status      string   `json:"status"`
+	Differences []string `json:"differences"`
+}
+
+// CodeHash identifies the code both teams played with, so a battle can't be
+// verified after one of its prompts was changed.
+func CodeHash(codeA string, codeB string) string {
+	hash := sha256.Sum256([]byte(codeA + "\x00" + codeB))
+	return hex.EncodeToString(hash[:])
+}
+
+// VerifyBattle plays the stored battle again with the same prompt outputs,
+// seed and units and compares the replay with the stored result. The status
+// is saved on the battle.
+func VerifyBattle(app core.App, battleID string) (Verification, error) {
+	battle, err := app.FindRecordById("battle", battleID)
+	if err != nil {
+		return Verification{}, err
+	}
+
+	verification := Verification{BattleID: battle.Id}
+	verification.Status, verification.Differences, err = replayBattle(app, battle)
+	if err != nil {
+		verification.Status = VerificationError
+		verification.Differences = []string{err.Error()}
+	}
+
+	battle.Set("verification", verification.Status)
+	battle.Set("verification_error", strings.Join(verification.Differences, "\n"))
+	battle.Set("verified", types.NowDateTime())
+	if err := app.Save(battle); err != nil {
+		return verification, fmt.Errorf("error saving verification: %w", err)
+	}
+	return verification, nil
+}
+
+func replayBattle(app core.App, battle *core.Record) (string, []string, error) {
+	stored, err := LoadBattle(app, battle)
+	if err != nil {
+		return "", nil, fmt.Errorf("error decoding battle: %w", err)
+	}
+
+	if battle.GetString("prompt_a") == "" || battle.GetString("prompt_b") == "" {
+		return "", nil, errors.New("battle prompts are unknown")
+	}
+	promptA, err := app.FindRecordById("prompt", battle.GetString("prompt_a"))
+	if err != nil {
+		return "", nil, fmt.Errorf("error fetching prompt a: %w", err)
+	}
+	promptB, err := app.FindRecordById("prompt", battle.GetString("prompt_b"))
+	if err != nil {
+		return "", nil, fmt.Errorf("error fetching prompt b: %w", err)
+	}
+	codeA, codeB := promptA.GetString("output"), promptB.GetString("output")
+	hash := battle.GetString("code_hash")
+	if hash != "" && hash != CodeHash(codeA, codeB) {
+		return VerificationPromptChanged, []string{"prompt output changed after the battle"}, nil
+	}
+
+	options := world.GameOptions{Seed: stored.Seed, Scenario: stored.Scenario}
+	var diffs []string
+	// the starting position must come from the recorded scenario, unit IDs of
+	// older battles were global and can't be reproduced
+	expected, err := world.NewGameState(options)
+	if err != nil {
+		return "", nil, err
+	}
+	if !world.SameUnitsLayout(expected.CopyUnits(), stored.InitUnits) {
+		diffs = append(diffs, "initial units don't match the scenario")
+	}
+
+	match, err := NewMatch(codeA, codeB)
+	if err != nil {
+		return "", nil, err
+	}
+	defer match.Close()
+	options.Units = stored.InitUnits
+	replayed, err := world.RunGameWithOptions(options, match.GetTeamNextAction)
+	if err != nil {
+		return "", nil, fmt.Errorf("error running replay: %w", err)
+	}
+
+	diffs = append(diffs, world.CompareResults(stored, replayed, verificationDiffLimit)...)
+	if len(diffs) > 0 {
+		return VerificationMismatch, diffs, nil
+	}
+	return VerificationOK, nil, nil
+}
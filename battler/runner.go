@@ -26,6 +26,7 @@ func GetBattleResult(
 	if err != nil {
 		return world.Result{}, err
 	}
+	defer match.Close()
 	result, err := world.RunGame(match.GetTeamNextAction)
 
 	if err != nil {
@@ -52,10 +53,12 @@ func NewMatch(team1Text, team2Text string) (Match, error) {
 
 	team2FullProg, err := rules.AddGeneratedCodeToTheGameTemplate(team2Text, rules.LangJS)
 	if err != nil {
+		team1Action.Close()
 		return Match{}, err
 	}
 	team2Action, err := builder.NewQuickJSRunner(team2FullProg)
 	if err != nil {
+		team1Action.Close()
 		return Match{}, fmt.Errorf("error preparing js function: %w", err)
 	}
 
@@ -65,6 +68,12 @@ func NewMatch(team1Text, team2Text string) (Match, error) {
 	}, nil
 }
 
+// Close frees the runtimes of both teams.
+func (m Match) Close() {
+	m.teamOne.Close()
+	m.teamTwo.Close()
+}
+
 func (m Match) GetTeamNextAction(
 	team int, state world.GameState, unitID int, actionIndex string,
 ) (world.UnitAction, error) {
@@ -75,7 +84,7 @@ func (m Match) GetTeamNextAction(
 	case world.TeamB:
 		runner = m.teamTwo
 	default:
-		return world.UnitAction{}, fmt.Errorf("wrong team %s", team)
+		return world.UnitAction{}, fmt.Errorf("wrong team %d", team)
 	}
 	action, err := runner.GetNextAction(state, unitID, actionIndex)
 	if err != nil {
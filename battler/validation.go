@@ -0,0 +1,204 @@
+package battler
+
+import (
+	"aibattle/game/bots"
+	"aibattle/game/world"
+	"aibattle/pages/builder"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// MaxIllegalActionRate is the share of actions rejected by the game rules a
+// bot may have in validation games.
+const MaxIllegalActionRate = 0.2
+
+// number of differences reported when a repeated game differs
+const determinismDiffLimit = 3
+
+// smokeOpponent is played first, the other games are skipped when the bot
+// crashes or times out against it
+const smokeOpponent = bots.Rush
+
+// ValidationGame counts the problems of the validated bot in one game.
+type ValidationGame struct {
+	Opponent       string `json:"opponent"`
+	Team           string `json:"team"`
+	Winner         string `json:"winner"`
+	Actions        int    `json:"actions"`
+	Exceptions     int    `json:"exceptions"`
+	Timeouts       int    `json:"timeouts"`
+	IllegalActions int    `json:"illegal_actions"`
+	FirstError     string `json:"first_error,omitempty"`
+}
+
+// ValidationReport is stored on the prompt and explains why a bot was
+// rejected.
+type ValidationReport struct {
+	Passed        bool             `json:"passed"`
+	Reasons       []string         `json:"reasons,omitempty"`
+	Deterministic bool             `json:"deterministic"`
+	Games         []ValidationGame `json:"games"`
+}
+
+func (r ValidationReport) Err() error {
+	if r.Passed {
+		return nil
+	}
+	return fmt.Errorf("validation failed: %s", strings.Join(r.Reasons, "; "))
+}
+
+// Validate plays complete games against every reference bot on both teams,
+// and repeats the first game to check that the bot is deterministic, replays
+// of battles depend on it. The games against the smoke opponent come first,
+// a bot failing them is rejected without playing the rest.
+func Validate(code string) (ValidationReport, error) {
+	report := ValidationReport{Passed: true, Deterministic: true}
+	opponents := []string{smokeOpponent}
+	for _, name := range bots.Names {
+		if name != smokeOpponent {
+			opponents = append(opponents, name)
+		}
+	}
+	var first world.Result
+	var firstOpponent string
+	for _, name := range opponents {
+		if crashed(report.Games) {
+			break
+		}
+		opponent, err := bots.GetCode(name)
+		if err != nil {
+			return report, err
+		}
+		// the seed doesn't depend on the order of the games
+		seed := int64(slices.Index(bots.Names, name) + 1)
+		options := world.GameOptions{Seed: seed, Scenario: world.ScenarioRandom}
+		for _, team := range []int{world.TeamA, world.TeamB} {
+			result, game, err := playValidationGame(code, opponent, team, options)
+			if err != nil {
+				return report, err
+			}
+			game.Opponent = name
+			report.Games = append(report.Games, game)
+			if len(report.Games) == 1 {
+				first, firstOpponent = result, opponent
+			}
+		}
+	}
+
+	var diffs []string
+	if !crashed(report.Games) {
+		repeated, _, err := playValidationGame(
+			code, firstOpponent, world.TeamA,
+			world.GameOptions{Seed: first.Seed, Scenario: first.Scenario},
+		)
+		if err != nil {
+			return report, err
+		}
+		diffs = world.CompareResults(first, repeated, determinismDiffLimit)
+	}
+
+	actions, illegal := 0, 0
+	for _, game := range report.Games {
+		actions += game.Actions
+		illegal += game.IllegalActions
+		if game.Exceptions > 0 {
+			report.reject(
+				"exception in the game against %s as %s: %s", game.Opponent, game.Team,
+				game.FirstError,
+			)
+		}
+		if game.Timeouts > 0 {
+			report.reject("timeout in the game against %s as %s", game.Opponent, game.Team)
+		}
+	}
+	if actions > 0 && float64(illegal)/float64(actions) > MaxIllegalActionRate {
+		report.reject(
+			"%d of %d actions were illegal, at most %.0f%% are allowed", illegal, actions,
+			MaxIllegalActionRate*100,
+		)
+	}
+	if len(diffs) > 0 {
+		report.Deterministic = false
+		report.reject(
+			"the same game played twice differs (%s), avoid Math.random and Date",
+			strings.Join(diffs, ", "),
+		)
+	}
+	return report, nil
+}
+
+// crashed reports whether the bot raised an exception or timed out in a game.
+func crashed(games []ValidationGame) bool {
+	for _, game := range games {
+		if game.Exceptions > 0 || game.Timeouts > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ValidationReport) reject(format string, args ...any) {
+	r.Passed = false
+	r.Reasons = append(r.Reasons, fmt.Sprintf(format, args...))
+}
+
+func playValidationGame(
+	code string, opponent string, team int, options world.GameOptions,
+) (world.Result, ValidationGame, error) {
+	game := ValidationGame{Team: world.GetTeamName(team)}
+	codeA, codeB := code, opponent
+	if team == world.TeamB {
+		codeA, codeB = opponent, code
+	}
+	match, err := NewMatch(codeA, codeB)
+	if err != nil {
+		return world.Result{}, game, err
+	}
+	defer match.Close()
+
+	callErrors := 0
+	result, err := world.RunGameWithOptions(
+		options, func(
+			unitTeam int, state world.GameState, unitID int, actionIndex string,
+		) (world.UnitAction, error) {
+			action, err := match.GetTeamNextAction(unitTeam, state, unitID, actionIndex)
+			if err == nil || unitTeam != team {
+				return action, err
+			}
+			callErrors++
+			if errors.Is(err, builder.ErrInterrupted) {
+				game.Timeouts++
+			} else {
+				game.Exceptions++
+			}
+			if game.FirstError == "" {
+				game.FirstError = fmt.Sprintf("turn %d, unit %d: %v", state.Turn, unitID, err)
+			}
+			return action, err
+		},
+	)
+	if err != nil {
+		return result, game, err
+	}
+
+	teams := make(map[int]int, len(result.InitUnits))
+	for _, unit := range result.InitUnits {
+		teams[unit.ID] = unit.Team
+	}
+	failed := 0
+	for _, turn := range result.Turns {
+		if teams[turn.UnitID] != team {
+			continue
+		}
+		game.Actions++
+		if len(turn.Errors) > 0 {
+			failed++
+		}
+	}
+	// actions failing in the bot code are not played at all
+	game.IllegalActions = failed - callErrors
+	game.Winner = world.GetTeamName(result.Winner)
+	return result, game, nil
+}
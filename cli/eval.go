@@ -0,0 +1,388 @@
+package cli
+
+import (
+	"aibattle/battler"
+	"aibattle/game/bots"
+	"aibattle/game/world"
+	"aibattle/season"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+type EvalGame struct {
+	A       int
+	B       int
+	Options world.GameOptions
+	Winner  int
+	Err     error
+}
+
+type BotReport struct {
+	Name    string             `json:"name"`
+	Rating  float64            `json:"rating"`
+	Games   int                `json:"games"`
+	Wins    int                `json:"wins"`
+	Draws   int                `json:"draws"`
+	Losses  int                `json:"losses"`
+	Errors  int                `json:"errors"`
+	WinRate map[string]float64 `json:"win_rate"`
+}
+
+type EvalReport struct {
+	GamesPerPair int         `json:"games_per_pair"`
+	Scenario     string      `json:"scenario"`
+	Bots         []BotReport `json:"bots"`
+}
+
+// NewEvalCommand creates the command playing every pair of bots from the
+// directory against each other and reporting win rates and ratings.
+func NewEvalCommand() *cobra.Command {
+	var (
+		dir       string
+		games     int
+		workers   int
+		seed      int64
+		scenario  string
+		format    string
+		output    string
+		reference bool
+	)
+
+	command := &cobra.Command{
+		Use:          "eval",
+		Short:        "Runs every pair of bots from the directory many times",
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			if format != FormatCSV && format != FormatJSON {
+				return fmt.Errorf("unknown format %s", format)
+			}
+			names, codes, err := loadBotDir(dir, reference)
+			if err != nil {
+				return err
+			}
+			if len(names) < 2 {
+				return errors.New("at least two bots are needed")
+			}
+
+			log.SetOutput(io.Discard)
+			defer log.SetOutput(os.Stderr)
+
+			results := RunEval(
+				codes, EvalGames(len(names), games, seed, scenario), workers,
+				func(done int, total int) {
+					if done%100 == 0 || done == total {
+						fmt.Fprintf(command.ErrOrStderr(), "played %d/%d games\n", done, total)
+					}
+				},
+			)
+			for _, game := range results {
+				if game.Err != nil {
+					fmt.Fprintf(
+						command.ErrOrStderr(), "%s vs %s failed: %v\n", names[game.A], names[game.B],
+						game.Err,
+					)
+				}
+			}
+			report := BuildReport(names, results)
+			report.GamesPerPair = games
+			report.Scenario = scenario
+
+			out := command.OutOrStdout()
+			if output != "" {
+				file, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				out = file
+			}
+			if format == FormatJSON {
+				encoder := json.NewEncoder(out)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(report)
+			}
+			return WriteReportCSV(out, report)
+		},
+	}
+
+	command.Flags().StringVar(&dir, "bots", "", "directory with bot .js files")
+	command.Flags().IntVar(&games, "games", 100, "number of games for every pair of bots")
+	command.Flags().IntVar(&workers, "workers", runtime.NumCPU(), "number of games played in parallel")
+	command.Flags().Int64Var(&seed, "seed", 1, "seed of the first game, following games use the next seeds")
+	command.Flags().StringVar(&scenario, "scenario", world.ScenarioRandom, fmt.Sprintf("starting position, one of %v", world.Scenarios))
+	command.Flags().StringVar(&format, "format", FormatCSV, "output format, csv or json")
+	command.Flags().StringVar(&output, "output", "", "file to write the report to instead of stdout")
+	command.Flags().BoolVar(&reference, "reference", false, "add the built-in reference bots")
+	_ = command.MarkFlagRequired("bots")
+	return command
+}
+
+func loadBotDir(dir string, reference bool) ([]string, []string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.js"))
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(files)
+
+	var names, codes []string
+	for _, file := range files {
+		code, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		names = append(names, strings.TrimSuffix(filepath.Base(file), ".js"))
+		codes = append(codes, string(code))
+	}
+	if reference {
+		for _, name := range bots.Names {
+			code, err := bots.GetCode(name)
+			if err != nil {
+				return nil, nil, err
+			}
+			names = append(names, "reference:"+name)
+			codes = append(codes, code)
+		}
+	}
+	return names, codes, nil
+}
+
+// EvalGames lists the games for every pair of bots. Each seed is played twice
+// with the bots swapping sides.
+func EvalGames(botCount int, gamesPerPair int, seed int64, scenario string) []EvalGame {
+	var games []EvalGame
+	for a := 0; a < botCount; a++ {
+		for b := a + 1; b < botCount; b++ {
+			for i := range gamesPerPair {
+				game := EvalGame{
+					A:       a,
+					B:       b,
+					Options: world.GameOptions{Seed: seed + int64(i/2), Scenario: scenario},
+				}
+				if i%2 == 1 {
+					game.A, game.B = b, a
+				}
+				games = append(games, game)
+			}
+		}
+	}
+	return games
+}
+
+// RunEval plays the games in parallel, the results keep the order of games.
+func RunEval(
+	codes []string, games []EvalGame, workers int, progress func(done int, total int),
+) []EvalGame {
+	results := make([]EvalGame, len(games))
+	jobs := make(chan int)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		done int
+	)
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// QuickJS runtimes must stay on the thread they were created on
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			for i := range jobs {
+				game := games[i]
+				game.Winner, game.Err = playEvalGame(codes[game.A], codes[game.B], game.Options)
+				results[i] = game
+
+				mu.Lock()
+				done++
+				progress(done, len(games))
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range games {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func playEvalGame(codeA string, codeB string, options world.GameOptions) (int, error) {
+	match, err := battler.NewMatch(codeA, codeB)
+	if err != nil {
+		return world.Draw, err
+	}
+	defer match.Close()
+	result, err := world.RunGameWithOptions(options, match.GetTeamNextAction)
+	if err != nil {
+		return world.Draw, err
+	}
+	return result.Winner, nil
+}
+
+const (
+	// fitted ratings stop changing by more than this
+	ratingPrecision     = 0.01
+	maxRatingIterations = 10000
+	// rating change for a score one point above the expected one
+	ratingStep = 200
+)
+
+// BuildReport counts the results of every bot. Ratings are fitted to all
+// games at once, so they don't depend on the order of bots or games.
+func BuildReport(names []string, games []EvalGame) EvalReport {
+	reports := make([]BotReport, len(names))
+	points := make([][]float64, len(names))
+	played := make([][]int, len(names))
+	for i, name := range names {
+		reports[i] = BotReport{Name: name, WinRate: make(map[string]float64)}
+		points[i] = make([]float64, len(names))
+		played[i] = make([]int, len(names))
+	}
+
+	for _, game := range games {
+		a, b := &reports[game.A], &reports[game.B]
+		if game.Err != nil {
+			a.Errors++
+			b.Errors++
+			continue
+		}
+		a.Games++
+		b.Games++
+		played[game.A][game.B]++
+		played[game.B][game.A]++
+
+		switch game.Winner {
+		case world.TeamA:
+			a.Wins++
+			b.Losses++
+			points[game.A][game.B]++
+		case world.TeamB:
+			b.Wins++
+			a.Losses++
+			points[game.B][game.A]++
+		default:
+			a.Draws++
+			b.Draws++
+			points[game.A][game.B] += 0.5
+			points[game.B][game.A] += 0.5
+		}
+	}
+
+	ratings := fitRatings(points, played)
+	for i := range reports {
+		reports[i].Rating = ratings[i]
+		for j, name := range names {
+			if played[i][j] > 0 {
+				reports[i].WinRate[name] = points[i][j] / float64(played[i][j])
+			}
+		}
+	}
+	sort.SliceStable(
+		reports, func(i, j int) bool {
+			return reports[i].Rating > reports[j].Rating
+		},
+	)
+	return EvalReport{Bots: reports}
+}
+
+// fitRatings finds ELO ratings whose expected scores match the points of every
+// bot. All ratings move at once by the difference between the points and the
+// expected points, and are centered on the initial score. A virtual draw
+// between every pair which played keeps ratings of unbeaten bots finite.
+func fitRatings(points [][]float64, played [][]int) []float64 {
+	ratings := make([]float64, len(points))
+	for i := range ratings {
+		ratings[i] = season.InitialScore
+	}
+	deltas := make([]float64, len(points))
+	for range maxRatingIterations {
+		change := 0.0
+		for i := range ratings {
+			var diff, games float64
+			for j := range ratings {
+				if played[i][j] == 0 {
+					continue
+				}
+				n := float64(played[i][j] + 1)
+				expected := n / (1 + math.Pow(10, (ratings[j]-ratings[i])/400))
+				diff += points[i][j] + 0.5 - expected
+				games += n
+			}
+			deltas[i] = 0
+			if games > 0 {
+				deltas[i] = ratingStep * diff / games
+			}
+		}
+		mean := 0.0
+		for i := range ratings {
+			ratings[i] += deltas[i]
+			mean += ratings[i]
+		}
+		mean /= float64(len(ratings))
+		for i := range ratings {
+			ratings[i] += season.InitialScore - mean
+			change = max(change, math.Abs(deltas[i]))
+		}
+		if change < ratingPrecision {
+			break
+		}
+	}
+	return ratings
+}
+
+// WriteReportCSV writes one row per bot with the win rate against every
+// other bot, the row bot is the one winning.
+func WriteReportCSV(w io.Writer, report EvalReport) error {
+	writer := csv.NewWriter(w)
+	header := []string{"bot", "rating", "games", "wins", "draws", "losses", "errors"}
+	for _, bot := range report.Bots {
+		header = append(header, bot.Name)
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, bot := range report.Bots {
+		row := []string{
+			bot.Name,
+			strconv.FormatFloat(bot.Rating, 'f', 0, 64),
+			strconv.Itoa(bot.Games),
+			strconv.Itoa(bot.Wins),
+			strconv.Itoa(bot.Draws),
+			strconv.Itoa(bot.Losses),
+			strconv.Itoa(bot.Errors),
+		}
+		for _, opponent := range report.Bots {
+			rate, ok := bot.WinRate[opponent.Name]
+			if !ok {
+				row = append(row, "")
+				continue
+			}
+			row = append(row, strconv.FormatFloat(rate, 'f', 3, 64))
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
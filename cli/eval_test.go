@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"aibattle/game/world"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalGames(t *testing.T) {
+	games := EvalGames(3, 4, 10, world.ScenarioRandom)
+	assert.Len(t, games, 12)
+
+	// every seed is played from both sides
+	assert.Equal(t, 0, games[0].A)
+	assert.Equal(t, 1, games[1].A)
+	assert.Equal(t, games[0].Options, games[1].Options)
+	assert.Equal(t, int64(11), games[2].Options.Seed)
+}
+
+func TestBuildReport(t *testing.T) {
+	games := []EvalGame{
+		{A: 0, B: 1, Winner: world.TeamA},
+		{A: 1, B: 0, Winner: world.TeamB},
+		{A: 0, B: 2, Winner: world.Draw},
+		{A: 2, B: 0, Winner: world.TeamA},
+		{A: 1, B: 2, Err: errors.New("syntax error")},
+	}
+	report := BuildReport([]string{"a", "b", "c"}, games)
+
+	// c scored 75% against a, which won every game against b
+	assert.Equal(t, []string{"c", "a", "b"}, botNames(report))
+	a := report.Bots[1]
+	assert.Equal(t, 4, a.Games)
+	assert.Equal(t, 2, a.Wins)
+	assert.Equal(t, 1, a.Draws)
+	assert.Equal(t, 1, a.Losses)
+	assert.Equal(t, map[string]float64{"b": 1, "c": 0.25}, a.WinRate)
+	assert.Greater(t, a.Rating, report.Bots[2].Rating)
+	assert.Equal(t, 1, report.Bots[2].Errors)
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteReportCSV(&buf, report))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, "bot,rating,games,wins,draws,losses,errors,c,a,b", lines[0])
+	assert.True(t, strings.HasPrefix(lines[2], "a,"))
+	assert.True(t, strings.HasSuffix(lines[2], ",0.250,,1.000"))
+}
+
+func TestBuildReportIgnoresOrder(t *testing.T) {
+	games := []EvalGame{
+		{A: 0, B: 1, Winner: world.TeamA},
+		{A: 1, B: 2, Winner: world.TeamA},
+		{A: 2, B: 0, Winner: world.Draw},
+		{A: 0, B: 1, Winner: world.TeamA},
+		{A: 2, B: 1, Winner: world.TeamB},
+	}
+	report := BuildReport([]string{"a", "b", "c"}, games)
+
+	// the same games listed backwards with the bots in reverse order
+	reversed := make([]EvalGame, len(games))
+	for i, game := range games {
+		reversed[len(games)-1-i] = EvalGame{A: 2 - game.A, B: 2 - game.B, Winner: game.Winner}
+	}
+	other := BuildReport([]string{"c", "b", "a"}, reversed)
+
+	require.Equal(t, botNames(report), botNames(other))
+	for i := range report.Bots {
+		assert.InDelta(t, report.Bots[i].Rating, other.Bots[i].Rating, 0.1, report.Bots[i].Name)
+	}
+}
+
+func botNames(report EvalReport) []string {
+	names := make([]string, len(report.Bots))
+	for i, bot := range report.Bots {
+		names[i] = bot.Name
+	}
+	return names
+}
@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"aibattle/battler"
+	"aibattle/game/bots"
+	"aibattle/game/world"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// NewMatchCommand creates the command running a single game between two bot
+// files without the web server and the database.
+func NewMatchCommand() *cobra.Command {
+	var (
+		botA     string
+		botB     string
+		seed     int64
+		scenario string
+		output   string
+		verbose  bool
+	)
+
+	command := &cobra.Command{
+		Use:          "match",
+		Short:        "Runs a game between two bot files",
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			if !verbose {
+				log.SetOutput(io.Discard)
+				defer log.SetOutput(os.Stderr)
+			}
+
+			result, err := RunMatch(botA, botB, world.GameOptions{Seed: seed, Scenario: scenario})
+			if err != nil {
+				return err
+			}
+			PrintSummary(command.OutOrStdout(), botA, botB, result)
+
+			if output != "" {
+				data, err := json.MarshalIndent(result, "", "  ")
+				if err != nil {
+					return err
+				}
+				if err := os.WriteFile(output, data, 0o644); err != nil {
+					return fmt.Errorf("error writing result: %w", err)
+				}
+			}
+			return nil
+		},
+	}
+
+	command.Flags().StringVar(&botA, "a", "", "team A bot file or reference bot name")
+	command.Flags().StringVar(&botB, "b", "", "team B bot file or reference bot name")
+	command.Flags().Int64Var(&seed, "seed", 0, "seed for scenarios with random placement")
+	command.Flags().StringVar(&scenario, "scenario", world.ScenarioDefault, fmt.Sprintf("starting position, one of %v", world.Scenarios))
+	command.Flags().StringVar(&output, "output", "", "file to write the game result JSON to")
+	command.Flags().BoolVar(&verbose, "verbose", false, "print the game log")
+	_ = command.MarkFlagRequired("a")
+	_ = command.MarkFlagRequired("b")
+	return command
+}
+
+// LoadBot reads the bot code from the file, names of the reference bots can
+// be used instead of a file.
+func LoadBot(path string) (string, error) {
+	code, err := os.ReadFile(path)
+	if err == nil {
+		return string(code), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	botCode, botErr := bots.GetCode(path)
+	if botErr != nil {
+		return "", fmt.Errorf("error reading bot %s: %w", path, err)
+	}
+	return botCode, nil
+}
+
+func RunMatch(botA string, botB string, options world.GameOptions) (world.Result, error) {
+	codeA, err := LoadBot(botA)
+	if err != nil {
+		return world.Result{}, err
+	}
+	codeB, err := LoadBot(botB)
+	if err != nil {
+		return world.Result{}, err
+	}
+	match, err := battler.NewMatch(codeA, codeB)
+	if err != nil {
+		return world.Result{}, err
+	}
+	defer match.Close()
+	return world.RunGameWithOptions(options, match.GetTeamNextAction)
+}
+
+func PrintSummary(w io.Writer, botA string, botB string, result world.Result) {
+	names := map[int]string{world.TeamA: botA, world.TeamB: botB}
+	if result.Winner == world.Draw {
+		fmt.Fprintln(w, "Result: draw")
+	} else {
+		fmt.Fprintf(w, "Result: %s (%s) wins\n", world.GetTeamName(result.Winner), names[result.Winner])
+	}
+
+	lastTurn := 0
+	errorCount := make(map[int]int)
+	teams := make(map[int]int, len(result.InitUnits))
+	for _, unit := range result.InitUnits {
+		teams[unit.ID] = unit.Team
+	}
+	for _, turn := range result.Turns {
+		lastTurn = max(lastTurn, turn.Turn)
+		if len(turn.Errors) > 0 {
+			errorCount[teams[turn.UnitID]]++
+		}
+	}
+	fmt.Fprintf(
+		w, "Scenario: %s, seed %d, %d turns, %d actions\n",
+		result.Scenario, result.Seed, lastTurn+1, len(result.Turns),
+	)
+
+	finalUnits := result.FinalUnits()
+	for _, team := range []int{world.TeamA, world.TeamB} {
+		fmt.Fprintf(w, "\n%s (%s)\n", world.GetTeamName(team), names[team])
+		for _, unit := range finalUnits {
+			if unit.Team == team {
+				fmt.Fprintf(w, "  %-8s %3d/%d HP\n", unit.Type, max(unit.HP, 0), unit.MaxHP)
+			}
+		}
+
+		damage := result.DamageByUnitType(team)
+		unitTypes := make([]string, 0, len(damage))
+		for unitType := range damage {
+			unitTypes = append(unitTypes, unitType)
+		}
+		sort.Strings(unitTypes)
+		for _, unitType := range unitTypes {
+			fmt.Fprintf(w, "  %-8s dealt %d damage\n", unitType, damage[unitType])
+		}
+		fmt.Fprintf(w, "  failed actions: %d\n", errorCount[team])
+	}
+}
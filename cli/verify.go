@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"aibattle/battler"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// NewVerifyCommand creates the command replaying stored battles and checking
+// that the replay gives the same result.
+func NewVerifyCommand(app core.App) *cobra.Command {
+	var (
+		all     bool
+		verbose bool
+	)
+
+	command := &cobra.Command{
+		Use:          "verify [battle ids]",
+		Short:        "Replays stored battles and compares them with the stored results",
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			if !verbose {
+				log.SetOutput(io.Discard)
+				defer log.SetOutput(os.Stderr)
+			}
+
+			ids := args
+			if all {
+				if err := app.DB().Select("id").From("battle").OrderBy("created ASC").Column(&ids); err != nil {
+					return fmt.Errorf("error fetching battles: %w", err)
+				}
+			}
+			if len(ids) == 0 {
+				return errors.New("no battles to verify, pass battle ids or --all")
+			}
+
+			failed := 0
+			for _, id := range ids {
+				verification, err := battler.VerifyBattle(app, id)
+				if err != nil {
+					return fmt.Errorf("error verifying battle %s: %w", id, err)
+				}
+				fmt.Fprintf(command.OutOrStdout(), "%s %s\n", id, verification.Status)
+				for _, diff := range verification.Differences {
+					fmt.Fprintf(command.OutOrStdout(), "  %s\n", diff)
+				}
+				if verification.Status != battler.VerificationOK {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d battles failed verification", failed, len(ids))
+			}
+			return nil
+		},
+	}
+
+	command.Flags().BoolVar(&all, "all", false, "verify every stored battle")
+	command.Flags().BoolVar(&verbose, "verbose", false, "print the game log")
+	return command
+}
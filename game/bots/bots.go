@@ -0,0 +1,33 @@
+package bots
+
+import (
+	"embed"
+	"fmt"
+)
+
+// Reference bots contain only the GetTurnActions implementation and are added
+// to the language template the same way as generated code.
+const (
+	Random      = "random"
+	Rush        = "rush"
+	KiteAndHeal = "kite"
+)
+
+var Names = []string{Random, Rush, KiteAndHeal}
+
+var Titles = map[string]string{
+	Random:      "Random bot",
+	Rush:        "Rush nearest bot",
+	KiteAndHeal: "Kite and heal bot",
+}
+
+//go:embed *.js
+var botsFS embed.FS
+
+func GetCode(name string) (string, error) {
+	code, err := botsFS.ReadFile(name + ".js")
+	if err != nil {
+		return "", fmt.Errorf("unknown reference bot %s", name)
+	}
+	return string(code), nil
+}
@@ -0,0 +1,80 @@
+package bots_test
+
+import (
+	"aibattle/battler"
+	"aibattle/game/bots"
+	"aibattle/game/world"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBotsPlayWithoutErrors(t *testing.T) {
+	for _, name := range bots.Names {
+		for _, opponent := range bots.Names {
+			code, err := bots.GetCode(name)
+			require.NoError(t, err)
+			opponentCode, err := bots.GetCode(opponent)
+			require.NoError(t, err)
+
+			match, err := battler.NewMatch(code, opponentCode)
+			require.NoError(t, err)
+			defer match.Close()
+			result, err := world.RunGame(match.GetTeamNextAction)
+			require.NoError(t, err)
+
+			for _, turn := range result.Turns {
+				assert.Empty(t, turn.Errors, "%s vs %s", name, opponent)
+			}
+			t.Logf("%s vs %s: winner %d after %d actions", name, opponent, result.Winner, len(result.Turns))
+		}
+	}
+}
+
+func TestGetCodeUnknown(t *testing.T) {
+	_, err := bots.GetCode("unknown")
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	for _, name := range bots.Names {
+		code, err := bots.GetCode(name)
+		require.NoError(t, err)
+		report, err := battler.Validate(code)
+		require.NoError(t, err)
+		assert.True(t, report.Passed, "%s: %v", name, report.Reasons)
+		assert.Len(t, report.Games, 2*len(bots.Names))
+	}
+
+	failing := `function GetTurnActions(gameState, currentUnitID, actionIndex) {
+  if (gameState.turn > 1) throw new Error("boom");
+  return {action: "skip", target: null};
+}`
+	report, err := battler.Validate(failing)
+	require.NoError(t, err)
+	assert.False(t, report.Passed)
+	assert.ErrorContains(t, report.Err(), "boom")
+	// only the smoke games against the rush bot are played
+	require.Len(t, report.Games, 2)
+	for _, game := range report.Games {
+		assert.Equal(t, bots.Rush, game.Opponent)
+	}
+
+	illegal := `function GetTurnActions(gameState, currentUnitID, actionIndex) {
+  return {action: "attack1", target: {x: 100, y: 100}};
+}`
+	report, err = battler.Validate(illegal)
+	require.NoError(t, err)
+	assert.False(t, report.Passed)
+	assert.ErrorContains(t, report.Err(), "illegal")
+
+	random := `function GetTurnActions(gameState, currentUnitID, actionIndex) {
+  const unit = getCurrentUnit(gameState, currentUnitID);
+  const x = Math.min(9, Math.max(0, unit.position.x + Math.round(Math.random() * 2 - 1)));
+  return {action: "move", target: {x: x, y: unit.position.y}};
+}`
+	report, err = battler.Validate(random)
+	require.NoError(t, err)
+	assert.False(t, report.Deterministic, report.Reasons)
+}
@@ -0,0 +1,81 @@
+function kiteMostWounded(gameState, unit, units) {
+  return units
+    .filter((u) => u.hp < u.maxHp && canAttack(gameState, unit, u, "skill1"))
+    .sort((a, b) => a.hp / a.maxHp - b.hp / b.maxHp)[0];
+}
+
+function kiteWeakestInRange(gameState, unit, enemies, actionName) {
+  return enemies
+    .filter((enemy) => canAttack(gameState, unit, enemy, actionName))
+    .sort((a, b) => a.hp - b.hp)[0];
+}
+
+function kiteRetreatPosition(gameState, unit, enemies, keepInRange) {
+  const distance = getAvailableActions(gameState, unit.type).move?.distance ?? 0;
+  let best = null;
+  let bestScore = -Infinity;
+  for (let dx = -distance; dx <= distance; dx++) {
+    for (let dy = -distance; dy <= distance; dy++) {
+      const position = { x: unit.position.x + dx, y: unit.position.y + dy };
+      if (calculateEuclideanDistance(unit.position, position) > distance) continue;
+      if (!isValidPosition(gameState, position)) continue;
+      const closest = Math.min(...enemies.map((e) => calculateEuclideanDistance(position, e.position)));
+      if (keepInRange && closest > keepInRange) continue;
+      if (closest > bestScore) {
+        bestScore = closest;
+        best = position;
+      }
+    }
+  }
+  return best;
+}
+
+function GetTurnActions(gameState, currentUnitID, actionIndex) {
+  const unit = getCurrentUnit(gameState, currentUnitID);
+  if (!unit) return { action: "hold" };
+  const actions = getAvailableActions(gameState, unit.type);
+  const enemies = getEnemyUnits(gameState, currentUnitID);
+  const friends = getFriendlyUnits(gameState, currentUnitID);
+  const nearest = findNearestEnemy(unit, enemies);
+  if (!nearest) return { action: "hold" };
+  const nearestDistance = calculateEuclideanDistance(unit.position, nearest.position);
+  const firstAction = actionIndex === "FirstAction";
+
+  if (actions.skill1?.effect === "heal") {
+    const wounded = kiteMostWounded(gameState, unit, friends.concat([unit]));
+    if (wounded) return { action: "skill1", target: wounded.position };
+    if (firstAction && nearestDistance <= 2) {
+      const position = kiteRetreatPosition(gameState, unit, enemies, 0);
+      if (position) return { action: "move", target: position };
+    }
+    const front = friends.sort((a, b) => b.maxHp - a.maxHp)[0];
+    if (firstAction && front && calculateEuclideanDistance(unit.position, front.position) > 3) {
+      const position = getMovePositionToward(gameState, unit, front.position);
+      if (position) return { action: "move", target: position };
+    }
+    return { action: "hold" };
+  }
+
+  if (actions.skill1?.effect === "range") {
+    const target = kiteWeakestInRange(gameState, unit, enemies, "skill1");
+    if (firstAction && nearestDistance <= 2) {
+      const position = kiteRetreatPosition(gameState, unit, enemies, actions.skill1.range);
+      if (position) return { action: "move", target: position };
+    }
+    if (target) return { action: "skill1", target: target.position };
+    if (firstAction) {
+      const position = getMovePositionToward(gameState, unit, nearest.position);
+      if (position) return { action: "move", target: position };
+    }
+    return { action: "hold" };
+  }
+
+  const target = kiteWeakestInRange(gameState, unit, enemies, "attack1");
+  if (target) return { action: "attack1", target: target.position };
+  if (firstAction) {
+    const weakest = enemies.sort((a, b) => a.hp - b.hp)[0];
+    const position = getMovePositionToward(gameState, unit, weakest.position);
+    if (position) return { action: "move", target: position };
+  }
+  return { action: "hold" };
+}
@@ -0,0 +1,45 @@
+function botRandom(seed) {
+  const x = Math.sin(seed) * 10000;
+  return x - Math.floor(x);
+}
+
+function botPick(items, seed) {
+  return items[Math.floor(botRandom(seed) * items.length) % items.length];
+}
+
+function GetTurnActions(gameState, currentUnitID, actionIndex) {
+  const unit = getCurrentUnit(gameState, currentUnitID);
+  if (!unit) return { action: "hold" };
+  const actions = getAvailableActions(gameState, unit.type);
+  const seed = gameState.turn * 1000 + currentUnitID * 10 + (actionIndex === "FirstAction" ? 1 : 2);
+
+  const options = [{ action: "hold" }];
+  const enemies = getEnemyUnits(gameState, currentUnitID);
+  const friends = getFriendlyUnits(gameState, currentUnitID);
+
+  for (const enemy of enemies) {
+    if (canAttack(gameState, unit, enemy, "attack1")) {
+      options.push({ action: "attack1", target: enemy.position });
+    }
+  }
+  if (actions.skill1) {
+    const targets = actions.skill1.effect === "heal" ? friends.concat([unit]) : enemies;
+    for (const target of targets) {
+      if (canAttack(gameState, unit, target, "skill1")) {
+        options.push({ action: "skill1", target: target.position });
+      }
+    }
+  }
+  if (actionIndex === "FirstAction" && actions.move) {
+    const distance = actions.move.distance;
+    for (let dx = -distance; dx <= distance; dx++) {
+      for (let dy = -distance; dy <= distance; dy++) {
+        const position = { x: unit.position.x + dx, y: unit.position.y + dy };
+        if (calculateEuclideanDistance(unit.position, position) <= distance && isValidPosition(gameState, position)) {
+          options.push({ action: "move", target: position });
+        }
+      }
+    }
+  }
+  return botPick(options, seed);
+}
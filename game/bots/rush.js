@@ -0,0 +1,19 @@
+function GetTurnActions(gameState, currentUnitID, actionIndex) {
+  const unit = getCurrentUnit(gameState, currentUnitID);
+  if (!unit) return { action: "hold" };
+  const actions = getAvailableActions(gameState, unit.type);
+  const enemy = findNearestEnemy(unit, getEnemyUnits(gameState, currentUnitID));
+  if (!enemy) return { action: "hold" };
+
+  if (actions.skill1?.effect === "range" && canAttack(gameState, unit, enemy, "skill1")) {
+    return { action: "skill1", target: enemy.position };
+  }
+  if (canAttack(gameState, unit, enemy, "attack1")) {
+    return { action: "attack1", target: enemy.position };
+  }
+  if (actionIndex === "FirstAction") {
+    const position = getMovePositionToward(gameState, unit, enemy.position);
+    if (position) return { action: "move", target: position };
+  }
+  return { action: "hold" };
+}
@@ -0,0 +1,458 @@
+package world
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Replay format
+//
+//	magic "AIBR", version
+//	header: seed, scenario, unit action map as JSON, initial units
+//	records: one per action, closed by an end record with the winner and logs
+//
+// Actions store only the unit fields changed by the action, so a replay is
+// read from the start keeping the current state of every unit. Numbers are
+// varints and strings are prefixed with their length.
+const (
+	ReplayMagic   = "AIBR"
+	ReplayVersion = 1
+)
+
+const (
+	recordEnd byte = iota
+	recordAction
+)
+
+// unit change flags
+const (
+	changeHP byte = 1 << iota
+	changePosition
+	changeFull
+)
+
+// protects the decoder from allocating huge strings for corrupted data
+const maxReplayString = 1 << 24
+
+var ErrNotReplay = errors.New("data is not a replay")
+
+// ReplayHeader is the part of the result known before the game starts.
+type ReplayHeader struct {
+	Seed          int64
+	Scenario      string
+	UnitActionMap map[string]ActionMap
+	InitUnits     []Unit
+}
+
+// IsReplay checks whether the data starts with the replay magic.
+func IsReplay(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ReplayMagic))
+}
+
+func EncodeReplay(result Result) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder, err := NewReplayEncoder(
+		&buf, ReplayHeader{
+			Seed:          result.Seed,
+			Scenario:      result.Scenario,
+			UnitActionMap: result.UnitActionMap,
+			InitUnits:     result.InitUnits,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, action := range result.Turns {
+		if err := encoder.WriteAction(action); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Close(result.Winner, result.TeamOneLogs, result.TeamTwoLogs); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func DecodeReplay(data []byte) (Result, error) {
+	decoder, err := NewReplayDecoder(bytes.NewReader(data))
+	if err != nil {
+		return Result{}, err
+	}
+	header := decoder.Header()
+	result := Result{
+		InitUnits:     header.InitUnits,
+		UnitActionMap: header.UnitActionMap,
+		Seed:          header.Seed,
+		Scenario:      header.Scenario,
+	}
+	for {
+		action, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Result{}, err
+		}
+		result.Turns = append(result.Turns, action)
+	}
+	result.Winner, result.TeamOneLogs, result.TeamTwoLogs = decoder.End()
+	return result, nil
+}
+
+// ReplayEncoder writes the replay while the game is played.
+type ReplayEncoder struct {
+	w     io.Writer
+	buf   []byte
+	units map[int]Unit
+}
+
+func NewReplayEncoder(w io.Writer, header ReplayHeader) (*ReplayEncoder, error) {
+	actionMap, err := json.Marshal(header.UnitActionMap)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &ReplayEncoder{w: w, units: make(map[int]Unit, len(header.InitUnits))}
+	e.buf = append(e.buf, ReplayMagic...)
+	e.buf = binary.AppendUvarint(e.buf, ReplayVersion)
+	e.buf = binary.AppendVarint(e.buf, header.Seed)
+	e.appendString(header.Scenario)
+	e.appendString(string(actionMap))
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(header.InitUnits)))
+	for _, unit := range header.InitUnits {
+		e.appendUnit(unit)
+		e.units[unit.ID] = unit
+	}
+	return e, e.flush()
+}
+
+func (e *ReplayEncoder) WriteAction(action ActionLog) error {
+	e.buf = append(e.buf, recordAction)
+	e.buf = binary.AppendVarint(e.buf, int64(action.Turn))
+	e.buf = binary.AppendVarint(e.buf, int64(action.UnitID))
+	e.appendString(string(action.UnitAction.Action))
+	if target := action.UnitAction.Target; target != nil {
+		e.buf = append(e.buf, 1)
+		e.buf = binary.AppendVarint(e.buf, int64(target.X))
+		e.buf = binary.AppendVarint(e.buf, int64(target.Y))
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(action.Errors)))
+	for _, actionErr := range action.Errors {
+		e.appendString(actionErr)
+	}
+
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(action.UnitsAfter)))
+	for _, after := range action.UnitsAfter {
+		e.buf = binary.AppendVarint(e.buf, int64(after.ID))
+		before, known := e.units[after.ID]
+		var flags byte
+		switch {
+		case !known || before.Team != after.Team || before.Type != after.Type ||
+			before.Initiative != after.Initiative || before.MaxHP != after.MaxHP:
+			flags = changeFull
+		default:
+			if before.HP != after.HP {
+				flags |= changeHP
+			}
+			if before.Position != after.Position {
+				flags |= changePosition
+			}
+		}
+		e.buf = append(e.buf, flags)
+		switch {
+		case flags&changeFull != 0:
+			e.appendUnit(after)
+		default:
+			if flags&changeHP != 0 {
+				e.buf = binary.AppendVarint(e.buf, int64(after.HP))
+			}
+			if flags&changePosition != 0 {
+				e.buf = binary.AppendVarint(e.buf, int64(after.Position.X))
+				e.buf = binary.AppendVarint(e.buf, int64(after.Position.Y))
+			}
+		}
+		e.units[after.ID] = after
+	}
+	return e.flush()
+}
+
+// Close writes the end record, the encoder can't be used after it.
+func (e *ReplayEncoder) Close(winner int, teamOneLogs string, teamTwoLogs string) error {
+	e.buf = append(e.buf, recordEnd)
+	e.buf = binary.AppendVarint(e.buf, int64(winner))
+	e.appendString(teamOneLogs)
+	e.appendString(teamTwoLogs)
+	return e.flush()
+}
+
+func (e *ReplayEncoder) appendString(s string) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *ReplayEncoder) appendUnit(unit Unit) {
+	e.buf = binary.AppendVarint(e.buf, int64(unit.ID))
+	e.buf = binary.AppendVarint(e.buf, int64(unit.Team))
+	e.appendString(unit.Type)
+	e.buf = binary.AppendVarint(e.buf, int64(unit.Initiative))
+	e.buf = binary.AppendVarint(e.buf, int64(unit.HP))
+	e.buf = binary.AppendVarint(e.buf, int64(unit.MaxHP))
+	e.buf = binary.AppendVarint(e.buf, int64(unit.Position.X))
+	e.buf = binary.AppendVarint(e.buf, int64(unit.Position.Y))
+}
+
+func (e *ReplayEncoder) flush() error {
+	_, err := e.w.Write(e.buf)
+	e.buf = e.buf[:0]
+	return err
+}
+
+// ReplayDecoder reads the actions of a replay one by one.
+type ReplayDecoder struct {
+	r      *bufio.Reader
+	header ReplayHeader
+	units  map[int]Unit
+
+	done        bool
+	winner      int
+	teamOneLogs string
+	teamTwoLogs string
+}
+
+func NewReplayDecoder(r io.Reader) (*ReplayDecoder, error) {
+	d := &ReplayDecoder{r: bufio.NewReader(r)}
+
+	magic := make([]byte, len(ReplayMagic))
+	if _, err := io.ReadFull(d.r, magic); err != nil || string(magic) != ReplayMagic {
+		return nil, ErrNotReplay
+	}
+	version, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return nil, d.wrap(err)
+	}
+	if version != ReplayVersion {
+		return nil, fmt.Errorf("unsupported replay version %d", version)
+	}
+
+	if d.header.Seed, err = binary.ReadVarint(d.r); err != nil {
+		return nil, d.wrap(err)
+	}
+	if d.header.Scenario, err = d.readString(); err != nil {
+		return nil, err
+	}
+	actionMap, err := d.readString()
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(actionMap), &d.header.UnitActionMap); err != nil {
+		return nil, fmt.Errorf("error decoding replay: %w", err)
+	}
+
+	count, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return nil, d.wrap(err)
+	}
+	d.units = make(map[int]Unit, min(count, 64))
+	for range count {
+		unit, err := d.readUnit()
+		if err != nil {
+			return nil, err
+		}
+		d.header.InitUnits = append(d.header.InitUnits, unit)
+		d.units[unit.ID] = unit
+	}
+	return d, nil
+}
+
+func (d *ReplayDecoder) Header() ReplayHeader {
+	return d.header
+}
+
+// Next returns the next action, io.EOF is returned after the last one.
+func (d *ReplayDecoder) Next() (ActionLog, error) {
+	if d.done {
+		return ActionLog{}, io.EOF
+	}
+	tag, err := d.r.ReadByte()
+	if err != nil {
+		return ActionLog{}, d.wrap(err)
+	}
+	switch tag {
+	case recordEnd:
+		return ActionLog{}, d.readEnd()
+	case recordAction:
+		return d.readAction()
+	default:
+		return ActionLog{}, fmt.Errorf("error decoding replay: unknown record %d", tag)
+	}
+}
+
+// End returns the winner and team logs, they are known after Next returned
+// io.EOF.
+func (d *ReplayDecoder) End() (int, string, string) {
+	return d.winner, d.teamOneLogs, d.teamTwoLogs
+}
+
+func (d *ReplayDecoder) readEnd() error {
+	winner, err := binary.ReadVarint(d.r)
+	if err != nil {
+		return d.wrap(err)
+	}
+	d.winner = int(winner)
+	if d.teamOneLogs, err = d.readString(); err != nil {
+		return err
+	}
+	if d.teamTwoLogs, err = d.readString(); err != nil {
+		return err
+	}
+	d.done = true
+	return io.EOF
+}
+
+func (d *ReplayDecoder) readAction() (ActionLog, error) {
+	var action ActionLog
+	var err error
+	if action.Turn, err = d.readInt(); err != nil {
+		return action, err
+	}
+	if action.UnitID, err = d.readInt(); err != nil {
+		return action, err
+	}
+	name, err := d.readString()
+	if err != nil {
+		return action, err
+	}
+	action.UnitAction.Action = Action(name)
+
+	hasTarget, err := d.r.ReadByte()
+	if err != nil {
+		return action, d.wrap(err)
+	}
+	if hasTarget == 1 {
+		var target Position
+		if target.X, err = d.readInt(); err != nil {
+			return action, err
+		}
+		if target.Y, err = d.readInt(); err != nil {
+			return action, err
+		}
+		action.UnitAction.Target = &target
+	}
+
+	errorCount, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return action, d.wrap(err)
+	}
+	for range errorCount {
+		actionErr, err := d.readString()
+		if err != nil {
+			return action, err
+		}
+		action.Errors = append(action.Errors, actionErr)
+	}
+
+	changeCount, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return action, d.wrap(err)
+	}
+	for range changeCount {
+		id, err := d.readInt()
+		if err != nil {
+			return action, err
+		}
+		flags, err := d.r.ReadByte()
+		if err != nil {
+			return action, d.wrap(err)
+		}
+		unit := d.units[id]
+		if flags&changeFull != 0 {
+			if unit, err = d.readUnit(); err != nil {
+				return action, err
+			}
+		}
+		if flags&changeHP != 0 {
+			if unit.HP, err = d.readInt(); err != nil {
+				return action, err
+			}
+		}
+		if flags&changePosition != 0 {
+			if unit.Position.X, err = d.readInt(); err != nil {
+				return action, err
+			}
+			if unit.Position.Y, err = d.readInt(); err != nil {
+				return action, err
+			}
+		}
+		d.units[id] = unit
+		action.UnitsAfter = append(action.UnitsAfter, unit)
+	}
+	return action, nil
+}
+
+func (d *ReplayDecoder) readUnit() (Unit, error) {
+	var unit Unit
+	var err error
+	if unit.ID, err = d.readInt(); err != nil {
+		return unit, err
+	}
+	if unit.Team, err = d.readInt(); err != nil {
+		return unit, err
+	}
+	if unit.Type, err = d.readString(); err != nil {
+		return unit, err
+	}
+	if unit.Initiative, err = d.readInt(); err != nil {
+		return unit, err
+	}
+	if unit.HP, err = d.readInt(); err != nil {
+		return unit, err
+	}
+	if unit.MaxHP, err = d.readInt(); err != nil {
+		return unit, err
+	}
+	if unit.Position.X, err = d.readInt(); err != nil {
+		return unit, err
+	}
+	if unit.Position.Y, err = d.readInt(); err != nil {
+		return unit, err
+	}
+	return unit, nil
+}
+
+func (d *ReplayDecoder) readInt() (int, error) {
+	value, err := binary.ReadVarint(d.r)
+	if err != nil {
+		return 0, d.wrap(err)
+	}
+	return int(value), nil
+}
+
+func (d *ReplayDecoder) readString() (string, error) {
+	length, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return "", d.wrap(err)
+	}
+	if length > maxReplayString {
+		return "", errors.New("error decoding replay: string is too long")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(d.r, data); err != nil {
+		return "", d.wrap(err)
+	}
+	return string(data), nil
+}
+
+func (d *ReplayDecoder) wrap(err error) error {
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("error decoding replay: %w", err)
+}
@@ -0,0 +1,78 @@
+package world
+
+import (
+	"fmt"
+	"slices"
+)
+
+// CompareResults lists up to limit differences between a stored game and its
+// replay, no differences means the game was reproduced exactly.
+func CompareResults(stored Result, replayed Result, limit int) []string {
+	var diffs []string
+	add := func(format string, args ...any) bool {
+		diffs = append(diffs, fmt.Sprintf(format, args...))
+		return len(diffs) >= limit
+	}
+
+	if !slices.Equal(stored.InitUnits, replayed.InitUnits) {
+		if add("initial units differ") {
+			return diffs
+		}
+	}
+	if stored.Winner != replayed.Winner {
+		if add("winner %s, replay winner %s", GetTeamName(stored.Winner), GetTeamName(replayed.Winner)) {
+			return diffs
+		}
+	}
+	if len(stored.Turns) != len(replayed.Turns) {
+		if add("%d actions, replay has %d actions", len(stored.Turns), len(replayed.Turns)) {
+			return diffs
+		}
+	}
+
+	for i := range min(len(stored.Turns), len(replayed.Turns)) {
+		s, r := stored.Turns[i], replayed.Turns[i]
+		var diff string
+		switch {
+		case s.Turn != r.Turn || s.UnitID != r.UnitID:
+			diff = fmt.Sprintf("turn %d unit %d, replay turn %d unit %d", s.Turn, s.UnitID, r.Turn, r.UnitID)
+		case !sameAction(s.UnitAction, r.UnitAction):
+			diff = fmt.Sprintf("action %s, replay action %s", formatAction(s.UnitAction), formatAction(r.UnitAction))
+		case !slices.Equal(s.Errors, r.Errors):
+			diff = fmt.Sprintf("errors %q, replay errors %q", s.Errors, r.Errors)
+		case !slices.Equal(s.UnitsAfter, r.UnitsAfter):
+			diff = "units after the action differ"
+		default:
+			continue
+		}
+		if add("action %d (turn %d unit %d): %s", i, s.Turn, s.UnitID, diff) {
+			return diffs
+		}
+	}
+	return diffs
+}
+
+// SameUnitsLayout checks that units have the same types, teams, health and
+// positions ignoring their IDs.
+func SameUnitsLayout(a []Unit, b []Unit) bool {
+	return slices.EqualFunc(
+		a, b, func(u1 Unit, u2 Unit) bool {
+			u1.ID, u2.ID = 0, 0
+			return u1 == u2
+		},
+	)
+}
+
+func sameAction(a UnitAction, b UnitAction) bool {
+	if a.Action != b.Action || (a.Target == nil) != (b.Target == nil) {
+		return false
+	}
+	return a.Target == nil || *a.Target == *b.Target
+}
+
+func formatAction(action UnitAction) string {
+	if action.Target == nil {
+		return fmt.Sprintf("%q", action.Action)
+	}
+	return fmt.Sprintf("%q to %d,%d", action.Action, action.Target.X, action.Target.Y)
+}
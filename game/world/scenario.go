@@ -0,0 +1,126 @@
+package world
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/samber/lo"
+)
+
+const (
+	ScenarioDefault = "default"
+	ScenarioRandom  = "random"
+)
+
+var Scenarios = []string{ScenarioDefault, ScenarioRandom}
+
+const (
+	mapWidth  = 20
+	mapHeight = 20
+	// number of rows near the own map edge used by the random scenario
+	deployRows = 3
+)
+
+// GameOptions selects the starting position of a game. The seed only affects
+// scenarios with random placement, the game itself is deterministic.
+type GameOptions struct {
+	Seed     int64
+	Scenario string
+	// Units replace the scenario units, used to replay stored games with
+	// their original unit IDs.
+	Units []Unit
+}
+
+func DefaultOptions() GameOptions {
+	return GameOptions{Scenario: ScenarioDefault}
+}
+
+// NewGameState creates the initial state for the scenario. Unit IDs are
+// assigned per game, so the same options always produce the same state.
+func NewGameState(options GameOptions) (GameState, error) {
+	var units []*Unit
+	switch options.Scenario {
+	case ScenarioDefault, "":
+		units = defaultUnits()
+	case ScenarioRandom:
+		units = randomUnits(rand.New(rand.NewSource(options.Seed)))
+	default:
+		return GameState{}, fmt.Errorf("unknown scenario %s", options.Scenario)
+	}
+	for i, unit := range units {
+		unit.ID = i + 1
+	}
+	if len(options.Units) > 0 {
+		units = make([]*Unit, len(options.Units))
+		for i, unit := range options.Units {
+			units[i] = &unit
+		}
+	}
+
+	sort.Slice(
+		units, func(i, j int) bool {
+			return units[i].Initiative > units[j].Initiative
+		},
+	)
+
+	unitIDtoUnit := lo.KeyBy(
+		units, func(item *Unit) int {
+			return item.ID
+		},
+	)
+
+	return GameState{
+		Turn:          0,
+		Units:         units,
+		Width:         mapWidth,
+		Height:        mapHeight,
+		UnitActionMap: UnitActionMap,
+		IDToUnit:      unitIDtoUnit,
+	}, nil
+}
+
+func defaultUnits() []*Unit {
+	return []*Unit{
+		// Team A starting positions
+		NewWarrior(TeamA, Position{X: 4, Y: 1}),
+		NewHealer(TeamA, Position{X: 3, Y: 1}),
+		NewMage(TeamA, Position{X: 2, Y: 1}),
+		NewRogue(TeamA, Position{X: 1, Y: 1}),
+
+		NewWarrior(TeamB, Position{15, 18}),
+		NewHealer(TeamB, Position{16, 18}),
+		NewMage(TeamB, Position{17, 18}),
+		NewRogue(TeamB, Position{X: 18, Y: 18}),
+	}
+}
+
+// randomUnits places team A units near the top edge and mirrors the positions
+// for team B, so both teams get the same start.
+func randomUnits(rng *rand.Rand) []*Unit {
+	used := make(map[Position]bool)
+	positions := make([]Position, 0, 4)
+	for len(positions) < 4 {
+		pos := Position{X: rng.Intn(mapWidth), Y: rng.Intn(deployRows)}
+		if used[pos] {
+			continue
+		}
+		used[pos] = true
+		positions = append(positions, pos)
+	}
+	mirror := func(pos Position) Position {
+		return Position{X: mapWidth - 1 - pos.X, Y: mapHeight - 1 - pos.Y}
+	}
+
+	return []*Unit{
+		NewWarrior(TeamA, positions[0]),
+		NewHealer(TeamA, positions[1]),
+		NewMage(TeamA, positions[2]),
+		NewRogue(TeamA, positions[3]),
+
+		NewWarrior(TeamB, mirror(positions[0])),
+		NewHealer(TeamB, mirror(positions[1])),
+		NewMage(TeamB, mirror(positions[2])),
+		NewRogue(TeamB, mirror(positions[3])),
+	}
+}
@@ -0,0 +1,42 @@
+package world
+
+// DamageByUnitType sums the damage the team's units dealt to enemy units,
+// grouped by the attacking unit type.
+func (r Result) DamageByUnitType(team int) map[string]int {
+	units := make(map[int]Unit, len(r.InitUnits))
+	for _, unit := range r.InitUnits {
+		units[unit.ID] = unit
+	}
+
+	dealt := make(map[string]int)
+	for _, turn := range r.Turns {
+		actor, actorFound := units[turn.UnitID]
+		for _, after := range turn.UnitsAfter {
+			before := units[after.ID]
+			if actorFound && actor.Team == team && after.Team != team && before.HP > after.HP {
+				dealt[actor.Type] += before.HP - after.HP
+			}
+			units[after.ID] = after
+		}
+	}
+	return dealt
+}
+
+// FinalUnits returns every unit in its state after the last turn, dead units
+// included.
+func (r Result) FinalUnits() []Unit {
+	units := make([]Unit, len(r.InitUnits))
+	index := make(map[int]int, len(r.InitUnits))
+	for i, unit := range r.InitUnits {
+		units[i] = unit
+		index[unit.ID] = i
+	}
+	for _, turn := range r.Turns {
+		for _, after := range turn.UnitsAfter {
+			if i, ok := index[after.ID]; ok {
+				units[i] = after
+			}
+		}
+	}
+	return units
+}
@@ -3,7 +3,6 @@ package world
 import (
 	"errors"
 	"math"
-	"sort"
 
 	"github.com/samber/lo"
 )
@@ -61,42 +60,9 @@ const (
 )
 
 func GetInitialGameState() GameState {
-	units := make([]*Unit, 0)
-	addUnit := func(newUnit *Unit) {
-		units = append(units, newUnit)
-	}
-
-	// Team A starting positions
-	addUnit(NewWarrior(TeamA, Position{X: 4, Y: 1}))
-	addUnit(NewHealer(TeamA, Position{X: 3, Y: 1}))
-	addUnit(NewMage(TeamA, Position{X: 2, Y: 1}))
-	addUnit(NewRogue(TeamA, Position{X: 1, Y: 1}))
-
-	addUnit(NewWarrior(TeamB, Position{15, 18}))
-	addUnit(NewHealer(TeamB, Position{16, 18}))
-	addUnit(NewMage(TeamB, Position{17, 18}))
-	addUnit(NewRogue(TeamB, Position{X: 18, Y: 18}))
-
-	sort.Slice(
-		units, func(i, j int) bool {
-			return units[i].Initiative > units[j].Initiative
-		},
-	)
-
-	unitIDtoUnit := lo.KeyBy(
-		units, func(item *Unit) int {
-			return item.ID
-		},
-	)
-
-	return GameState{
-		Turn:          0,
-		Units:         units,
-		Width:         20,
-		Height:        20,
-		UnitActionMap: UnitActionMap,
-		IDToUnit:      unitIDtoUnit,
-	}
+	// the default scenario can't fail
+	state, _ := NewGameState(DefaultOptions())
+	return state
 }
 
 var unitNotFoundErr = errors.New("unit not found")
@@ -1,6 +1,8 @@
 package world
 
 import (
+	"cmp"
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -263,3 +265,130 @@ func TestCheckWinningTeam(t *testing.T) {
 	assert.True(t, gameOver)
 	assert.Equal(t, TeamB, winner)
 }
+
+func TestDamageByUnitType(t *testing.T) {
+	warrior := Unit{ID: 1, Team: TeamA, Type: WARRIOR, HP: 200}
+	mage := Unit{ID: 2, Team: TeamA, Type: MAGE, HP: 120}
+	rogue := Unit{ID: 3, Team: TeamB, Type: ROGUE, HP: 130}
+
+	woundedRogue := rogue
+	woundedRogue.HP = 100
+	burnedRogue := woundedRogue
+	burnedRogue.HP = 60
+	woundedMage := mage
+	woundedMage.HP = 95
+	movedWarrior := warrior
+	movedWarrior.Position = Position{X: 1, Y: 1}
+
+	result := Result{
+		InitUnits: []Unit{warrior, mage, rogue},
+		Turns: []ActionLog{
+			{UnitID: 1, UnitsAfter: []Unit{movedWarrior}},
+			{UnitID: 1, UnitsAfter: []Unit{woundedRogue}},
+			{UnitID: 2, UnitsAfter: []Unit{burnedRogue}},
+			{UnitID: 3, UnitsAfter: []Unit{woundedMage}},
+			{UnitID: 3, Errors: []string{"target is out of range"}},
+		},
+	}
+
+	assert.Equal(t, map[string]int{WARRIOR: 30, MAGE: 40}, result.DamageByUnitType(TeamA))
+	assert.Equal(t, map[string]int{ROGUE: 25}, result.DamageByUnitType(TeamB))
+}
+
+func TestRandomScenario(t *testing.T) {
+	options := GameOptions{Seed: 42, Scenario: ScenarioRandom}
+	state, err := NewGameState(options)
+	assert.NoError(t, err)
+	again, err := NewGameState(options)
+	assert.NoError(t, err)
+	assert.Equal(t, state.CopyUnits(), again.CopyUnits())
+
+	// team B gets mirrored positions of team A
+	for _, unit := range state.Units {
+		if unit.Team != TeamA {
+			continue
+		}
+		mirrored := Position{X: state.Width - 1 - unit.Position.X, Y: state.Height - 1 - unit.Position.Y}
+		enemy, err := state.FindUnit(mirrored)
+		assert.NoError(t, err)
+		assert.Equal(t, TeamB, enemy.Team)
+		assert.Equal(t, unit.Type, enemy.Type)
+	}
+
+	_, err = NewGameState(GameOptions{Scenario: "unknown"})
+	assert.Error(t, err)
+}
+
+func TestCompareResults(t *testing.T) {
+	units := []Unit{{ID: 1, Team: TeamA, Type: WARRIOR, HP: 200}}
+	stored := Result{
+		InitUnits: units,
+		Winner:    TeamA,
+		Turns: []ActionLog{
+			{UnitID: 1, UnitAction: UnitAction{Action: MOVE, Target: &Position{X: 1, Y: 2}}},
+			{UnitID: 1, UnitAction: UnitAction{Action: HOLD}},
+		},
+	}
+	replayed := stored
+	replayed.Turns = []ActionLog{
+		{UnitID: 1, UnitAction: UnitAction{Action: MOVE, Target: &Position{X: 1, Y: 2}}},
+		{UnitID: 1, UnitAction: UnitAction{Action: HOLD}, Errors: []string{}},
+	}
+	assert.Empty(t, CompareResults(stored, replayed, 10))
+
+	replayed.Winner = TeamB
+	replayed.Turns = []ActionLog{
+		{UnitID: 1, UnitAction: UnitAction{Action: MOVE, Target: &Position{X: 2, Y: 2}}},
+	}
+	assert.Len(t, CompareResults(stored, replayed, 10), 3)
+	assert.Len(t, CompareResults(stored, replayed, 1), 1)
+}
+
+func TestReplayRoundTrip(t *testing.T) {
+	// units walk to each other and attack, wrong targets produce errors
+	nextAction := func(team int, state GameState, unitID int, index string) (UnitAction, error) {
+		unit := state.IDToUnit[unitID]
+		for _, enemy := range state.Units {
+			if enemy.Team != team && CalculateDistance(unit.Position, enemy.Position) <= 1.5 {
+				return UnitAction{Action: ATTACK1, Target: &enemy.Position}, nil
+			}
+		}
+		if index == SecondAction {
+			return UnitAction{Action: HOLD}, nil
+		}
+		target := state.Units[0].Position
+		for _, enemy := range state.Units {
+			if enemy.Team != team {
+				target = enemy.Position
+			}
+		}
+		return UnitAction{
+			Action: MOVE, Target: &Position{
+				X: unit.Position.X + cmp.Compare(target.X, unit.Position.X),
+				Y: unit.Position.Y + cmp.Compare(target.Y, unit.Position.Y),
+			},
+		}, nil
+	}
+	result, err := RunGameWithOptions(GameOptions{Seed: 3, Scenario: ScenarioRandom}, nextAction)
+	assert.NoError(t, err)
+	assert.Equal(t, TeamA, result.Winner)
+	result.TeamOneLogs = "log line"
+
+	data, err := EncodeReplay(result)
+	assert.NoError(t, err)
+	assert.True(t, IsReplay(data))
+	decoded, err := DecodeReplay(data)
+	assert.NoError(t, err)
+
+	expected, err := json.Marshal(result)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(decoded)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(expected), string(actual))
+	assert.Less(t, len(data), len(expected)/4)
+
+	_, err = DecodeReplay(data[:len(data)/2])
+	assert.Error(t, err)
+	_, err = DecodeReplay(expected)
+	assert.ErrorIs(t, err, ErrNotReplay)
+}
@@ -21,6 +21,8 @@ type Result struct {
 	UnitActionMap map[string]ActionMap `json:"unit_action_map"`
 	TeamOneLogs   string               `json:"team_one_logs"`
 	TeamTwoLogs   string               `json:"team_two_logs"`
+	Seed          int64                `json:"seed,omitempty"`
+	Scenario      string               `json:"scenario,omitempty"`
 }
 
 func (r Result) NewActionLog(turn int, unitID int) ActionLog {
@@ -44,7 +46,19 @@ func RunGame(
 		int, GameState, int, string,
 	) (UnitAction, error),
 ) (Result, error) {
-	gameState := GetInitialGameState()
+	return RunGameWithOptions(DefaultOptions(), nextAction)
+}
+
+func RunGameWithOptions(
+	options GameOptions,
+	nextAction func(
+		int, GameState, int, string,
+	) (UnitAction, error),
+) (Result, error) {
+	gameState, err := NewGameState(options)
+	if err != nil {
+		return Result{}, err
+	}
 	maxTurns := 50
 
 	teamA := lo.Filter(
@@ -57,6 +71,8 @@ func RunGame(
 		Winner:        Draw,
 		InitUnits:     gameState.CopyUnits(),
 		UnitActionMap: gameState.UnitActionMap,
+		Seed:          options.Seed,
+		Scenario:      options.Scenario,
 	}
 
 	for turn := range maxTurns {
@@ -1,14 +1,22 @@
 package main
 
 import (
+	"aibattle/cli"
 	_ "aibattle/migrations"
 	"aibattle/pages"
+	"aibattle/pages/api"
 	"aibattle/pages/auth"
 	"aibattle/pages/battle"
 	"aibattle/pages/index"
+	"aibattle/pages/keys"
 	"aibattle/pages/leader"
 	"aibattle/pages/middleware"
 	"aibattle/pages/prompt"
+	"aibattle/pages/tournament"
+	"aibattle/pages/user"
+	"aibattle/season"
+	tournaments "aibattle/tournament"
+	"aibattle/usage"
 	"log"
 	"net/http"
 	"os"
@@ -31,13 +39,26 @@ func main() {
 			Automigrate: isGoRun,
 		},
 	)
+	app.RootCmd.AddCommand(
+		cli.NewMatchCommand(), cli.NewEvalCommand(), cli.NewVerifyCommand(app),
+	)
+
 	templ, err := pages.ParseTemplates()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// a wrong quota would reject every prompt
+	usage.Limits, err = usage.QuotasFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	app.OnServe().BindFunc(
 		func(se *core.ServeEvent) error {
+			if err := tournaments.FailInterrupted(app); err != nil {
+				return err
+			}
 			se.Router.Bind(apis.Gzip())
 			se.Router.Bind(middleware.LoadAuthToken())
 			se.Router.GET(
@@ -48,9 +69,31 @@ func main() {
 			se.Router.GET("/login", auth.Login(app, templ))
 			se.Router.POST("/login", auth.Login(app, templ))
 			se.Router.GET("/leader", leader.List(app, templ))
+			se.Router.GET("/user/{id}", user.Profile(app, templ))
+			se.Router.GET("/tournament", tournament.List(app, templ))
+			se.Router.GET("/tournament/{id}", tournament.Detailed(app, templ))
+			se.Router.GET("/tournament/{id}/match/{match}", tournament.Match(app, templ))
+			se.Router.POST("/admin/battle/{id}/verify", battle.Verify(app)).
+				Bind(apis.RequireSuperuserAuth())
+			se.Router.GET("/admin/usage", api.UsageReport(app)).
+				Bind(apis.RequireSuperuserAuth())
+			// tournaments play many battles at once
+			se.Router.POST("/tournament", tournament.Create(app, templ)).
+				Bind(apis.RequireSuperuserAuth())
 
 			se.Router.GET("/{$}", index.Landing(app, templ))
 
+			v1 := se.Router.Group("/api/v1").BindFunc(api.RequireAuth)
+			v1.GET("/battles", api.Battles(app))
+			v1.GET("/battles/{id}", api.BattleByID(app))
+			v1.GET("/leaderboard", api.LeaderboardList(app))
+			v1.GET("/prompts", api.Prompts(app))
+			v1.POST("/prompts", api.CreatePrompt(app))
+			v1.GET("/prompts/{id}", api.PromptByID(app))
+			v1.POST("/prompts/{id}/activate", api.ActivatePrompt(app))
+			v1.GET("/prompts/{id}/messages", api.PromptMessages(app))
+			v1.POST("/prompts/{id}/messages", api.SendPromptMessage(app))
+
 			withAuth(
 				se.Router.GET("/logout", auth.Logout(app, templ)),
 				se.Router.GET("/prompt", prompt.NewPromptForm(app, templ)),
@@ -58,14 +101,30 @@ func main() {
 				se.Router.GET("/prompt/{id}", prompt.DetailedPrompt(app, templ)),
 				se.Router.POST("/prompt/{id}", prompt.UpdatePrompt(app, templ)),
 				se.Router.POST("/prompt/{id}/activate", prompt.ActivatePrompt(app)),
+				se.Router.POST("/prompt/{id}/sandbox", prompt.Sandbox(app, templ)),
+				se.Router.POST("/prompt/{id}/message", prompt.SendMessage(app, templ)),
+				se.Router.GET("/prompt/{id}/diff/{other}", prompt.Diff(app, templ)),
+				se.Router.GET("/prompt/{id}/events", prompt.Events(app)).
+					Unbind(apis.DefaultGzipMiddlewareId),
 				se.Router.GET("/battle", battle.List(app, templ)),
 				se.Router.GET("/battle/{id}", battle.Detailed(app, templ)),
+				// the replay is already compressed
+				se.Router.GET("/battle/{id}/replay.json.gz", battle.Replay(app)).
+					Unbind(apis.DefaultGzipMiddlewareId),
+				se.Router.POST("/battle/{id}/improve", prompt.ImproveBattle(app, templ)),
 				se.Router.POST("/battle/run", battle.RunBattle(app, templ)),
+				se.Router.POST("/battle/challenge", battle.Challenge(app, templ)),
+				se.Router.GET("/keys", keys.List(app, templ)),
+				se.Router.POST("/keys", keys.Create(app, templ)),
+				se.Router.POST("/keys/{id}/revoke", keys.Revoke(app)),
 			)
 
 			go func() {
 				prompt.ProcessPrompts(app)
 			}()
+			go func() {
+				season.RunSeasonTask(app)
+			}()
 			return se.Next()
 		},
 	)
@@ -0,0 +1,158 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		jsonData := `{
+			"createRule": null,
+			"deleteRule": null,
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "pbc_1381739715",
+					"hidden": false,
+					"id": "relation3177167065",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "tournament",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"hidden": false,
+					"id": "number3320769076",
+					"max": null,
+					"min": 0,
+					"name": "round",
+					"onlyInt": true,
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"cascadeDelete": false,
+					"collectionId": "pbc_1442582902",
+					"hidden": false,
+					"id": "relation366277069",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "prompt_a",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"cascadeDelete": false,
+					"collectionId": "pbc_1442582902",
+					"hidden": false,
+					"id": "relation2363334775",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "prompt_b",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"cascadeDelete": false,
+					"collectionId": "pbc_613051002",
+					"hidden": false,
+					"id": "relation328800052",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "battle",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"hidden": false,
+					"id": "select325763347",
+					"maxSelect": 1,
+					"name": "result",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "select",
+					"values": [
+						"teamA",
+						"teamB",
+						"draw",
+						"bye",
+						"error"
+					]
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				},
+				{
+					"hidden": false,
+					"id": "autodate3332085495",
+					"name": "updated",
+					"onCreate": true,
+					"onUpdate": true,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_2717664617",
+			"indexes": [
+				"CREATE INDEX ` + "`" + `idx_Bw4cXo1LmE` + "`" + ` ON ` + "`" + `tournament_match` + "`" + ` (` + "`" + `tournament` + "`" + `)"
+			],
+			"listRule": null,
+			"name": "tournament_match",
+			"system": false,
+			"type": "base",
+			"updateRule": null,
+			"viewRule": null
+		}`
+
+		collection := &core.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2717664617")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,68 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_4192176570")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"indexes": [
+				"CREATE INDEX `+"`"+`idx_oGqp3A8tJW`+"`"+` ON `+"`"+`score`+"`"+` (`+"`"+`score`+"`"+`)",
+				"CREATE INDEX `+"`"+`idx_FJSZEfd8sW`+"`"+` ON `+"`"+`score`+"`"+` (`+"`"+`updated`+"`"+`)",
+				"CREATE UNIQUE INDEX `+"`"+`idx_0lZbp8WB55`+"`"+` ON `+"`"+`score`+"`"+` (\n  `+"`"+`user`+"`"+`,\n  `+"`"+`season`+"`"+`\n)"
+			]
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(3, []byte(`{
+			"cascadeDelete": false,
+			"collectionId": "pbc_737524280",
+			"hidden": false,
+			"id": "relation4041497513",
+			"maxSelect": 1,
+			"minSelect": 0,
+			"name": "season",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "relation"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_4192176570")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"indexes": [
+				"CREATE INDEX `+"`"+`idx_oGqp3A8tJW`+"`"+` ON `+"`"+`score`+"`"+` (`+"`"+`score`+"`"+`)",
+				"CREATE INDEX `+"`"+`idx_FJSZEfd8sW`+"`"+` ON `+"`"+`score`+"`"+` (`+"`"+`updated`+"`"+`)",
+				"CREATE UNIQUE INDEX `+"`"+`idx_0lZbp8WB55`+"`"+` ON `+"`"+`score`+"`"+` (`+"`"+`user`+"`"+`)"
+			]
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("relation4041497513")
+
+		return app.Save(collection)
+	})
+}
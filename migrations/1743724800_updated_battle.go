@@ -0,0 +1,165 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_613051002")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(2, []byte(`{
+			"cascadeDelete": false,
+			"collectionId": "pbc_1442582902",
+			"hidden": false,
+			"id": "relation366277069",
+			"maxSelect": 1,
+			"minSelect": 0,
+			"name": "prompt_a",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "relation"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(3, []byte(`{
+			"cascadeDelete": false,
+			"collectionId": "pbc_1442582902",
+			"hidden": false,
+			"id": "relation2363334775",
+			"maxSelect": 1,
+			"minSelect": 0,
+			"name": "prompt_b",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "relation"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(4, []byte(`{
+			"hidden": false,
+			"id": "select1525794059",
+			"maxSelect": 1,
+			"name": "verification",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "select",
+			"values": [
+				"ok",
+				"prompt_changed",
+				"mismatch",
+				"error"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(5, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text3274054945",
+			"max": 0,
+			"min": 0,
+			"name": "verification_error",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(6, []byte(`{
+			"hidden": false,
+			"id": "date256245529",
+			"max": "",
+			"min": "",
+			"name": "verified",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "date"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(7, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text3880978553",
+			"max": 0,
+			"min": 0,
+			"name": "code_hash",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		// prompts of older battles are known only from results and tournament matches
+		_, err = app.DB().NewQuery(`
+			UPDATE battle SET
+				prompt_a = COALESCE(
+					(SELECT prompt FROM battle_result WHERE battle_result.battle = battle.id AND team = 'teamA' LIMIT 1),
+					(SELECT prompt_a FROM tournament_match WHERE tournament_match.battle = battle.id LIMIT 1),
+					''
+				),
+				prompt_b = COALESCE(
+					(SELECT prompt FROM battle_result WHERE battle_result.battle = battle.id AND team = 'teamB' LIMIT 1),
+					(SELECT prompt_b FROM tournament_match WHERE tournament_match.battle = battle.id LIMIT 1),
+					''
+				)
+		`).Execute()
+		return err
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_613051002")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("relation366277069")
+
+		// remove field
+		collection.Fields.RemoveById("relation2363334775")
+
+		// remove field
+		collection.Fields.RemoveById("select1525794059")
+
+		// remove field
+		collection.Fields.RemoveById("text3274054945")
+
+		// remove field
+		collection.Fields.RemoveById("date256245529")
+
+		// remove field
+		collection.Fields.RemoveById("text3880978553")
+
+		return app.Save(collection)
+	})
+}
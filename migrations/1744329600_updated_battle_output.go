@@ -0,0 +1,92 @@
+package migrations
+
+import (
+	"aibattle/game/world"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// converts stored battle outputs between JSON results and the replay format
+func init() {
+	m.Register(func(app core.App) error {
+		return convertBattleOutputs(app, func(data []byte) ([]byte, error) {
+			if world.IsReplay(data) {
+				return nil, nil
+			}
+			var result world.Result
+			if err := json.Unmarshal(data, &result); err != nil {
+				return nil, err
+			}
+			return world.EncodeReplay(result)
+		})
+	}, func(app core.App) error {
+		return convertBattleOutputs(app, func(data []byte) ([]byte, error) {
+			if !world.IsReplay(data) {
+				return nil, nil
+			}
+			result, err := world.DecodeReplay(data)
+			if err != nil {
+				return nil, err
+			}
+			return json.Marshal(result)
+		})
+	})
+}
+
+// convertBattleOutputs rewrites every battle output, convert returns nil when
+// the output is already converted.
+func convertBattleOutputs(app core.App, convert func([]byte) ([]byte, error)) error {
+	var ids []string
+	if err := app.DB().Select("id").From("battle").Column(&ids); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		var output string
+		err := app.DB().Select("output").From("battle").
+			Where(dbx.HashExp{"id": id}).
+			Row(&output)
+		if err != nil {
+			return err
+		}
+
+		gzReader, err := gzip.NewReader(bytes.NewBufferString(output))
+		if err != nil {
+			return fmt.Errorf("battle %s: %w", id, err)
+		}
+		data, err := io.ReadAll(gzReader)
+		gzReader.Close()
+		if err != nil {
+			return fmt.Errorf("battle %s: %w", id, err)
+		}
+		converted, err := convert(data)
+		if err != nil {
+			return fmt.Errorf("battle %s: %w", id, err)
+		}
+		if converted == nil {
+			continue
+		}
+
+		var b bytes.Buffer
+		gz := gzip.NewWriter(&b)
+		if _, err := gz.Write(converted); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		_, err = app.DB().Update("battle", dbx.Params{"output": b.String()}, dbx.HashExp{"id": id}).
+			Execute()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
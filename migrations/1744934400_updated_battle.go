@@ -0,0 +1,115 @@
+package migrations
+
+import (
+	"io"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_613051002")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(2, []byte(`{
+			"hidden": false,
+			"id": "file3644323058",
+			"maxSelect": 1,
+			"maxSize": 52428800,
+			"mimeTypes": [],
+			"name": "replay",
+			"presentable": false,
+			"protected": false,
+			"required": false,
+			"system": false,
+			"thumbs": null,
+			"type": "file"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		// move stored outputs to files
+		return eachBattle(
+			app, "output != ''", func(battle *core.Record) error {
+				file, err := filesystem.NewFileFromBytes([]byte(battle.GetString("output")), "replay.gz")
+				if err != nil {
+					return err
+				}
+				battle.Set("replay", file)
+				battle.Set("output", "")
+				return app.Save(battle)
+			},
+		)
+	}, func(app core.App) error {
+		fsys, err := app.NewFilesystem()
+		if err != nil {
+			return err
+		}
+		defer fsys.Close()
+		err = eachBattle(
+			app, "replay != ''", func(battle *core.Record) error {
+				reader, err := fsys.GetFile(battle.BaseFilesPath() + "/" + battle.GetString("replay"))
+				if err != nil {
+					return err
+				}
+				data, err := io.ReadAll(reader)
+				reader.Close()
+				if err != nil {
+					return err
+				}
+				battle.Set("output", string(data))
+				return app.Save(battle)
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		collection, err := app.FindCollectionByNameOrId("pbc_613051002")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("file3644323058")
+
+		return app.Save(collection)
+	})
+}
+
+// battles loaded at once, outputs of all battles may not fit in memory
+const battleBatchSize = 100
+
+// eachBattle calls fn for the battles matching the filter in batches ordered
+// by id.
+func eachBattle(app core.App, filter string, fn func(battle *core.Record) error) error {
+	lastID := ""
+	for {
+		battles, err := app.FindRecordsByFilter(
+			"battle", "("+filter+") && id > {:id}", "id", battleBatchSize, 0,
+			dbx.Params{"id": lastID},
+		)
+		if err != nil {
+			return err
+		}
+		for _, battle := range battles {
+			if err := fn(battle); err != nil {
+				return err
+			}
+		}
+		if len(battles) < battleBatchSize {
+			return nil
+		}
+		lastID = battles[len(battles)-1].Id
+	}
+}
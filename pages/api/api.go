@@ -0,0 +1,92 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// List is the paginated response of every list endpoint, it follows the
+// shape of PocketBase record lists.
+type List[T any] struct {
+	Page       int   `json:"page"`
+	PerPage    int   `json:"perPage"`
+	TotalItems int64 `json:"totalItems"`
+	TotalPages int   `json:"totalPages"`
+	Items      []T   `json:"items"`
+}
+
+type pagination struct {
+	page    int
+	perPage int
+}
+
+func (p pagination) offset() int64 {
+	return int64((p.page - 1) * p.perPage)
+}
+
+// getPagination reads the page and perPage query parameters, pages start at 1.
+func getPagination(e *core.RequestEvent) (pagination, error) {
+	p := pagination{page: 1, perPage: defaultPerPage}
+	query := e.Request.URL.Query()
+	if value := query.Get("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return p, e.BadRequestError("page must be a positive number", err)
+		}
+		p.page = page
+	}
+	if value := query.Get("perPage"); value != "" {
+		perPage, err := strconv.Atoi(value)
+		if err != nil || perPage < 1 || perPage > maxPerPage {
+			return p, e.BadRequestError("perPage must be between 1 and 100", err)
+		}
+		p.perPage = perPage
+	}
+	return p, nil
+}
+
+func newList[T any](p pagination, total int64, items []T) List[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return List[T]{
+		Page:       p.page,
+		PerPage:    p.perPage,
+		TotalItems: total,
+		TotalPages: int(math.Ceil(float64(total) / float64(p.perPage))),
+		Items:      items,
+	}
+}
+
+// getBool reads an optional true/false query parameter.
+func getBool(e *core.RequestEvent, name string) (*bool, error) {
+	value := e.Request.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, e.BadRequestError(name+" must be true or false", err)
+	}
+	return &parsed, nil
+}
+
+// RequireAuth responds with 401 instead of redirecting to the login page.
+func RequireAuth(e *core.RequestEvent) error {
+	if e.Auth == nil {
+		return e.UnauthorizedError("authentication required", nil)
+	}
+	return e.Next()
+}
+
+func writeList[T any](e *core.RequestEvent, p pagination, total int64, items []T) error {
+	return e.JSON(http.StatusOK, newList(p, total, items))
+}
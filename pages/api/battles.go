@@ -0,0 +1,169 @@
+package api
+
+import (
+	"aibattle/battler"
+	"aibattle/game/world"
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/samber/lo"
+)
+
+var battleResults = []string{"won", "lost", "draw"}
+
+type Battle struct {
+	ID           string         `json:"id"`
+	BattleID     string         `json:"battle"`
+	UserID       string         `json:"user"`
+	PromptID     string         `json:"prompt"`
+	OpponentID   string         `json:"opponent"`
+	OpponentName string         `json:"opponentName"`
+	Team         string         `json:"team"`
+	Result       string         `json:"result"`
+	ScoreChange  float64        `json:"scoreChange"`
+	Rated        bool           `json:"rated"`
+	Created      types.DateTime `json:"created"`
+}
+
+type BattleDetail struct {
+	Battle
+	ReplayURL string       `json:"replayUrl"`
+	Game      world.Result `json:"game"`
+}
+
+// Battles lists battle results of the user.
+// Filters: opponent, prompt, result (won, lost, draw), rated, since, until.
+func Battles(app *pocketbase.PocketBase) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		p, err := getPagination(e)
+		if err != nil {
+			return err
+		}
+		filters, err := getBattleFilters(e)
+		if err != nil {
+			return err
+		}
+
+		total, err := app.CountRecords("battle_result", filters...)
+		if err != nil {
+			return err
+		}
+		var records []*core.Record
+		err = app.RecordQuery("battle_result").
+			AndWhere(dbx.And(filters...)).
+			OrderBy("created DESC", "id DESC").
+			Limit(int64(p.perPage)).
+			Offset(p.offset()).
+			All(&records)
+		if err != nil {
+			return err
+		}
+
+		expErr := app.ExpandRecords(records, []string{"opponent"}, nil)
+		if len(expErr) > 0 {
+			return lo.Values(expErr)[0]
+		}
+		return writeList(e, p, total, lo.Map(records, toBattle))
+	}
+}
+
+// BattleByID returns the user's battle result with the decoded game.
+func BattleByID(app *pocketbase.PocketBase) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		record, err := app.FindFirstRecordByFilter(
+			"battle_result", "id = {:id} && user = {:user}",
+			dbx.Params{"id": e.Request.PathValue("id"), "user": e.Auth.Id},
+		)
+		if errors.Is(err, sql.ErrNoRows) {
+			return e.NotFoundError("battle not found", err)
+		}
+		if err != nil {
+			return err
+		}
+
+		expErr := app.ExpandRecord(record, []string{"battle", "opponent"}, nil)
+		if len(expErr) > 0 {
+			return lo.Values(expErr)[0]
+		}
+		battleRecord := record.ExpandedOne("battle")
+		if battleRecord == nil {
+			return e.NotFoundError("battle not found", nil)
+		}
+		game, err := battler.LoadBattle(app, battleRecord)
+		if err != nil {
+			return err
+		}
+
+		return e.JSON(
+			http.StatusOK, BattleDetail{
+				Battle:    toBattle(record, 0),
+				ReplayURL: "/battle/" + record.Id + "/replay.json.gz",
+				Game:      game,
+			},
+		)
+	}
+}
+
+func getBattleFilters(e *core.RequestEvent) ([]dbx.Expression, error) {
+	query := e.Request.URL.Query()
+	filters := []dbx.Expression{dbx.HashExp{"user": e.Auth.Id}}
+
+	for _, name := range []string{"opponent", "prompt"} {
+		if value := query.Get(name); value != "" {
+			filters = append(filters, dbx.HashExp{name: value})
+		}
+	}
+	if result := query.Get("result"); result != "" {
+		if !slices.Contains(battleResults, result) {
+			return nil, e.BadRequestError("result must be one of won, lost, draw", nil)
+		}
+		filters = append(filters, dbx.HashExp{"result": result})
+	}
+	rated, err := getBool(e, "rated")
+	if err != nil {
+		return nil, err
+	}
+	if rated != nil {
+		filters = append(filters, dbx.HashExp{"rated": *rated})
+	}
+
+	for name, op := range map[string]string{"since": ">=", "until": "<"} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		date, err := types.ParseDateTime(value)
+		if err != nil || date.IsZero() {
+			return nil, e.BadRequestError(name+" must be a date", err)
+		}
+		filters = append(
+			filters, dbx.NewExp("created "+op+" {:"+name+"}", dbx.Params{name: date.String()}),
+		)
+	}
+	return filters, nil
+}
+
+func toBattle(record *core.Record, _ int) Battle {
+	battle := Battle{
+		ID:          record.Id,
+		BattleID:    record.GetString("battle"),
+		UserID:      record.GetString("user"),
+		PromptID:    record.GetString("prompt"),
+		OpponentID:  record.GetString("opponent"),
+		Team:        record.GetString("team"),
+		Result:      record.GetString("result"),
+		ScoreChange: record.GetFloat("score_change"),
+		Rated:       record.GetBool("rated"),
+		Created:     record.GetDateTime("created"),
+	}
+	if opponent := record.ExpandedOne("opponent"); opponent != nil {
+		battle.OpponentName = opponent.GetString("name")
+	}
+	return battle
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"aibattle/pages/leader"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type Season struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type LeaderboardEntry struct {
+	Rank     int     `json:"rank"`
+	UserID   string  `json:"user"`
+	Username string  `json:"username"`
+	Score    float64 `json:"score"`
+	Language string  `json:"language"`
+	Model    string  `json:"model"`
+}
+
+type Leaderboard struct {
+	List[LeaderboardEntry]
+	Season *Season `json:"season"`
+}
+
+// LeaderboardList returns season standings, the current season by default.
+func LeaderboardList(app *pocketbase.PocketBase) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		p, err := getPagination(e)
+		if err != nil {
+			return err
+		}
+		seasonID := e.Request.URL.Query().Get("season")
+		_, selected, err := leader.SelectSeason(app, seasonID)
+		if err != nil {
+			return err
+		}
+		if selected == nil && seasonID != "" {
+			return e.NotFoundError("season not found", nil)
+		}
+		scores, err := leader.GetScores(app, selected)
+		if err != nil {
+			return err
+		}
+
+		start := min(int(p.offset()), len(scores))
+		end := min(start+p.perPage, len(scores))
+		entries := make([]LeaderboardEntry, 0, end-start)
+		for i, score := range scores[start:end] {
+			entries = append(
+				entries, LeaderboardEntry{
+					Rank:     start + i + 1,
+					UserID:   score.UserID,
+					Username: score.Username,
+					Score:    score.Score,
+					Language: score.Language,
+					Model:    score.Model,
+				},
+			)
+		}
+
+		response := Leaderboard{List: newList(p, int64(len(scores)), entries)}
+		if selected != nil {
+			response.Season = &Season{ID: selected.Id, Name: selected.GetString("name")}
+		}
+		return e.JSON(http.StatusOK, response)
+	}
+}
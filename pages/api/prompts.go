@@ -0,0 +1,242 @@
+package api
+
+import (
+	"aibattle/battler"
+	"aibattle/pages/builder"
+	"aibattle/pages/prompt"
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/samber/lo"
+)
+
+var promptStatuses = []string{"done", "error"}
+
+type Prompt struct {
+	ID             string                    `json:"id"`
+	Kind           string                    `json:"kind"`
+	Text           string                    `json:"text"`
+	Output         string                    `json:"output"`
+	Strategy       string                    `json:"strategy"`
+	Explanation    string                    `json:"explanation"`
+	Error          string                    `json:"error"`
+	Status         string                    `json:"status"`
+	Parent         string                    `json:"parent"`
+	Language       string                    `json:"language"`
+	Model          string                    `json:"model"`
+	Temperature    float64                   `json:"temperature"`
+	ThinkingBudget int                       `json:"thinkingBudget"`
+	Active         bool                      `json:"active"`
+	Rating         float64                   `json:"rating"`
+	Validation     *battler.ValidationReport `json:"validation"`
+	Analysis       builder.Findings          `json:"analysis"`
+	Created        types.DateTime            `json:"created"`
+	Updated        types.DateTime            `json:"updated"`
+}
+
+// Prompts lists prompts of the user. Filters: status, active.
+func Prompts(app *pocketbase.PocketBase) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		p, err := getPagination(e)
+		if err != nil {
+			return err
+		}
+
+		filters := []dbx.Expression{dbx.HashExp{"user": e.Auth.Id}}
+		if status := e.Request.URL.Query().Get("status"); status != "" {
+			if !slices.Contains(promptStatuses, status) {
+				return e.BadRequestError("unknown status", nil)
+			}
+			filters = append(filters, dbx.HashExp{"status": status})
+		}
+		active, err := getBool(e, "active")
+		if err != nil {
+			return err
+		}
+		if active != nil {
+			filters = append(filters, dbx.HashExp{"active": *active})
+		}
+
+		total, err := app.CountRecords("prompt", filters...)
+		if err != nil {
+			return err
+		}
+		var records []*core.Record
+		err = app.RecordQuery("prompt").
+			AndWhere(dbx.And(filters...)).
+			OrderBy("created DESC", "id DESC").
+			Limit(int64(p.perPage)).
+			Offset(p.offset()).
+			All(&records)
+		if err != nil {
+			return err
+		}
+		return writeList(e, p, total, lo.Map(records, toPrompt))
+	}
+}
+
+// PromptByID returns the user's prompt, used to poll the generation status.
+func PromptByID(app *pocketbase.PocketBase) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		record, err := findUserPrompt(app, e)
+		if err != nil {
+			return err
+		}
+		return e.JSON(http.StatusOK, toPrompt(record, 0))
+	}
+}
+
+// CreatePrompt submits a new prompt, the code is generated or validated in
+// the background. Code prompts pass the source as text.
+func CreatePrompt(app *pocketbase.PocketBase) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		var body struct {
+			Kind           string   `json:"kind" form:"kind"`
+			Text           string   `json:"text" form:"text"`
+			Model          string   `json:"model" form:"model"`
+			Temperature    *float64 `json:"temperature" form:"temperature"`
+			ThinkingBudget int      `json:"thinkingBudget" form:"thinkingBudget"`
+		}
+		if err := e.BindBody(&body); err != nil {
+			return e.BadRequestError("invalid request body", err)
+		}
+
+		record, validationErr, err := prompt.CreateUpdatePrompt(
+			prompt.Data{
+				Kind: body.Kind,
+				Text: body.Text,
+				Options: builder.GenerationOptions{
+					Model:          body.Model,
+					Temperature:    lo.FromPtrOr(body.Temperature, builder.DefaultTemperature),
+					ThinkingBudget: body.ThinkingBudget,
+				},
+			}, e.Auth.Id, app, nil,
+		)
+		if err != nil {
+			return err
+		}
+		if validationErr != nil {
+			return e.BadRequestError(strings.Join(validationErr, " "), nil)
+		}
+		return e.JSON(http.StatusCreated, toPrompt(record, 0))
+	}
+}
+
+// ActivatePrompt makes the finished prompt the one playing rated battles.
+func ActivatePrompt(app *pocketbase.PocketBase) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		record, err := findUserPrompt(app, e)
+		if err != nil {
+			return err
+		}
+		if record.GetString("status") != "done" {
+			return e.BadRequestError("only finished prompts can be activated", nil)
+		}
+		record, err = prompt.Activate(app, e.Auth.Id, record.Id)
+		if err != nil {
+			return err
+		}
+		return e.JSON(http.StatusOK, toPrompt(record, 0))
+	}
+}
+
+func findUserPrompt(app *pocketbase.PocketBase, e *core.RequestEvent) (*core.Record, error) {
+	record, err := app.FindFirstRecordByFilter(
+		"prompt", "id = {:id} && user = {:user}",
+		dbx.Params{"id": e.Request.PathValue("id"), "user": e.Auth.Id},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, e.NotFoundError("prompt not found", err)
+	}
+	return record, err
+}
+
+func toPrompt(record *core.Record, _ int) Prompt {
+	return Prompt{
+		ID:             record.Id,
+		Kind:           prompt.GetKind(record),
+		Text:           record.GetString("text"),
+		Output:         record.GetString("output"),
+		Strategy:       record.GetString("strategy"),
+		Explanation:    record.GetString("explanation"),
+		Error:          record.GetString("error"),
+		Status:         record.GetString("status"),
+		Parent:         record.GetString("parent"),
+		Language:       record.GetString("language"),
+		Model:          record.GetString("model"),
+		Temperature:    record.GetFloat("temperature"),
+		ThinkingBudget: record.GetInt("thinking_budget"),
+		Active:         record.GetBool("active"),
+		Rating:         record.GetFloat("rating"),
+		Validation:     prompt.GetValidation(record),
+		Analysis:       prompt.GetAnalysis(record),
+		Created:        record.GetDateTime("created"),
+		Updated:        record.GetDateTime("updated"),
+	}
+}
+
+type PromptMessage struct {
+	Number      int            `json:"number"`
+	Role        string         `json:"role"`
+	Instruction string         `json:"instruction"`
+	Text        string         `json:"text"`
+	Created     types.DateTime `json:"created"`
+}
+
+// PromptMessages returns the whole conversation of the prompt with the model,
+// text is exactly what the model got or answered.
+func PromptMessages(app *pocketbase.PocketBase) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		record, err := findUserPrompt(app, e)
+		if err != nil {
+			return err
+		}
+		messages, err := prompt.GetMessages(app, record)
+		if err != nil {
+			return err
+		}
+		return e.JSON(http.StatusOK, lo.Map(messages, toPromptMessage))
+	}
+}
+
+// SendPromptMessage refines the prompt code with a follow-up instruction, the
+// result is a new version of the prompt.
+func SendPromptMessage(app *pocketbase.PocketBase) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		var body struct {
+			Text string `json:"text" form:"text"`
+		}
+		if err := e.BindBody(&body); err != nil {
+			return e.BadRequestError("invalid request body", err)
+		}
+		record, err := findUserPrompt(app, e)
+		if err != nil {
+			return err
+		}
+		newPrompt, validationErr, err := prompt.FollowUp(app, e.Auth.Id, record, body.Text)
+		if err != nil {
+			return err
+		}
+		if validationErr != nil {
+			return e.BadRequestError(strings.Join(validationErr, " "), nil)
+		}
+		return e.JSON(http.StatusCreated, toPrompt(newPrompt, 0))
+	}
+}
+
+func toPromptMessage(record *core.Record, _ int) PromptMessage {
+	return PromptMessage{
+		Number:      record.GetInt("number"),
+		Role:        record.GetString("role"),
+		Instruction: record.GetString("instruction"),
+		Text:        record.GetString("text"),
+		Created:     record.GetDateTime("created"),
+	}
+}
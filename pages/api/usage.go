@@ -0,0 +1,41 @@
+package api
+
+import (
+	"aibattle/usage"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// UsageReport is the token usage per user for superusers, the period is set
+// with since and until and defaults to the current month.
+func UsageReport(app *pocketbase.PocketBase) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		now := time.Now().UTC()
+		period := map[string]time.Time{
+			"since": time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC),
+			"until": {},
+		}
+		query := e.Request.URL.Query()
+		for name := range period {
+			value := query.Get(name)
+			if value == "" {
+				continue
+			}
+			date, err := types.ParseDateTime(value)
+			if err != nil || date.IsZero() {
+				return e.BadRequestError(name+" must be a date", err)
+			}
+			period[name] = date.Time()
+		}
+
+		entries, err := usage.Report(app, period["since"], period["until"])
+		if err != nil {
+			return err
+		}
+		return e.JSON(http.StatusOK, entries)
+	}
+}
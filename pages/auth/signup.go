@@ -2,6 +2,7 @@ package auth
 
 import (
 	"aibattle/pages"
+	"aibattle/season"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -40,17 +41,12 @@ func SignUp(app *pocketbase.PocketBase, templ *template.Template) func(e *core.R
 			if saveErr != nil {
 				data.Error = saveErr.Error()
 			} else {
-				scoreCollection, err := app.FindCollectionByNameOrId("score")
+				seasonID, err := season.CurrentID(app)
 				if err != nil {
 					return err
 				}
-
-				score := core.NewRecord(scoreCollection)
-				score.Set("score", 1000)
-				score.Set("user", newUser.Id)
-
-				if saveErr := app.Save(score); saveErr != nil {
-					return saveErr
+				if _, err := season.FindOrCreateScore(app, newUser.Id, seasonID); err != nil {
+					return err
 				}
 				return redirectWithCookie(e, newUser)
 			}
@@ -3,14 +3,11 @@ package battle
 import (
 	"aibattle/battler"
 	"aibattle/pages"
-	"bytes"
-	"compress/gzip"
+	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/samber/lo"
 	"html/template"
-	"io"
-	"log"
 	"net/http"
 	"time"
 
@@ -21,67 +18,77 @@ import (
 )
 
 type DetailView struct {
-	User     *core.Record
-	Battle   *core.Record
-	Output   string
-	MyTeam   string
-	Opponent string
+	User      *core.Record
+	ID        string
+	Battle    *core.Record
+	Output    string
+	MyTeam    string
+	Opponent  string
+	ReplayURL string
+	// set for the user's own battles
+	Feedback *battler.Feedback
+	Errors   []string
 }
 
 func Detailed(
 	app *pocketbase.PocketBase, templ *template.Template,
 ) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
-		id := e.Request.PathValue("id")
-
-		battleResult, err := app.FindRecordById("battle_result", id)
+		data, err := GetDetailView(app, e)
 		if err != nil {
 			return err
 		}
+		return pages.Render(e, templ, "battle/battle.gohtml", data)
+	}
+}
 
-		// Load battle relation
-		battleErr := app.ExpandRecord(battleResult, []string{"battle", "opponent"}, nil)
-		if len(battleErr) > 0 {
-			return errors.New("could not load battle data")
-		}
+// GetDetailView loads the battle result from the path, the feedback is added
+// for the user's own battles.
+func GetDetailView(app *pocketbase.PocketBase, e *core.RequestEvent) (*DetailView, error) {
+	id := e.Request.PathValue("id")
 
-		// Get the associated battle record
-		battle := battleResult.ExpandedOne("battle")
-		if battle == nil {
-			return errors.New("battle not found")
-		}
-		opponent := battleResult.ExpandedOne("opponent")
-		if opponent == nil {
-			return errors.New("opponent not found")
-		}
+	battleResult, err := app.FindRecordById("battle_result", id)
+	if err != nil {
+		return nil, err
+	}
 
-		outputString := battle.GetString("output")
+	// Load battle relation
+	battleErr := app.ExpandRecord(battleResult, []string{"battle", "opponent"}, nil)
+	if len(battleErr) > 0 {
+		return nil, errors.New("could not load battle data")
+	}
 
-		reader := bytes.NewReader([]byte(outputString))
-		gzReader, err := gzip.NewReader(reader)
-		if err != nil {
-			return err
-		}
-		defer func(gzReader *gzip.Reader) {
-			err := gzReader.Close()
-			if err != nil {
-				log.Println(err)
-			}
-		}(gzReader)
+	// Get the associated battle record
+	battle := battleResult.ExpandedOne("battle")
+	if battle == nil {
+		return nil, errors.New("battle not found")
+	}
+	opponent := battleResult.ExpandedOne("opponent")
+	if opponent == nil {
+		return nil, errors.New("opponent not found")
+	}
 
-		decompressed, err := io.ReadAll(gzReader)
+	decompressed, err := battler.LoadBattleJSON(app, battle)
+	if err != nil {
+		return nil, err
+	}
+	data := &DetailView{
+		User:      e.Auth,
+		ID:        battleResult.Id,
+		Battle:    battle,
+		Output:    decompressed,
+		MyTeam:    battleResult.GetString("team"),
+		Opponent:  opponent.GetString("name"),
+		ReplayURL: "/battle/" + battleResult.Id + "/replay.json.gz",
+	}
+	if e.Auth != nil && battleResult.GetString("user") == e.Auth.Id {
+		feedback, err := battler.LoadFeedback(app, battleResult)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		data := &DetailView{
-			User:     e.Auth,
-			Battle:   battle,
-			Output:   string(decompressed),
-			MyTeam:   battleResult.GetString("team"),
-			Opponent: opponent.GetString("name"),
-		}
-		return pages.Render(e, templ, "battle/battle.gohtml", data)
+		data.Feedback = &feedback
 	}
+	return data, nil
 }
 
 type ListView struct {
@@ -91,12 +98,15 @@ type ListView struct {
 	Opponent    string
 	Date        time.Time
 	PromptID    string
+	Rated       bool
 }
 
 type ListData struct {
-	User    *core.Record
-	Battles []ListView
-	Error   string
+	User            *core.Record
+	Battles         []ListView
+	Opponents       []*core.Record
+	SparringPrompts []*core.Record
+	Error           string
 }
 
 func List(app *pocketbase.PocketBase, templ *template.Template) func(e *core.RequestEvent) error {
@@ -113,14 +123,50 @@ func defaultList(
 		return battleErr
 	}
 
+	opponents, sparringPrompts, challengeErr := getChallengeOptions(e.Auth.Id, app)
+	if challengeErr != nil {
+		return challengeErr
+	}
+
 	data := &ListData{
-		User:    e.Auth,
-		Battles: battleViews,
-		Error:   error,
+		User:            e.Auth,
+		Battles:         battleViews,
+		Opponents:       opponents,
+		SparringPrompts: sparringPrompts,
+		Error:           error,
 	}
 	return pages.Render(e, templ, "battle/battle_list.gohtml", data)
 }
 
+// getChallengeOptions returns users with an active prompt and the user's own
+// prompts that can be used for sparring.
+func getChallengeOptions(
+	userID string, app *pocketbase.PocketBase,
+) ([]*core.Record, []*core.Record, error) {
+	var opponents []*core.Record
+	err := app.RecordQuery("users").
+		InnerJoin("prompt", dbx.NewExp("prompt.user = users.id AND prompt.active = TRUE")).
+		AndWhere(dbx.Not(dbx.HashExp{"users.id": userID})).
+		OrderBy("users.name ASC").
+		All(&opponents)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sparringPrompts, err := app.FindRecordsByFilter(
+		"prompt",
+		"user = {:user} && status = 'done' && active = false",
+		"-created",
+		20,
+		0,
+		dbx.Params{"user": userID},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return opponents, sparringPrompts, nil
+}
+
 func getUserBattles(userID string, app *pocketbase.PocketBase) ([]ListView, error) {
 	var battles []*core.Record
 	err := app.RecordQuery("battle_result").
@@ -146,6 +192,7 @@ func getUserBattles(userID string, app *pocketbase.PocketBase) ([]ListView, erro
 				PromptID:    b.GetString("prompt"),
 				Result:      b.GetString("result"),
 				Opponent:    userNames[b.GetString("opponent")],
+				Rated:       b.GetBool("rated"),
 			}
 		},
 	), nil
@@ -187,22 +234,9 @@ func RunBattle(
 			return defaultList(e, app, templ, limitError.Error())
 		}
 
-		// Find the active prompt for the current user
-		activePrompt, err := app.FindFirstRecordByFilter(
-			"prompt",
-			"user = {:user} && active = true",
-			dbx.Params{
-				"user": userId,
-			},
-		)
+		activePrompt, err := findActivePrompt(app, userId)
 		if err != nil {
-			if err.Error() == "sql: no rows in result set" {
-				return defaultList(
-					e, app, templ,
-					"You don't have an active prompt. Please activate a prompt before starting a battle.",
-				)
-			}
-			return defaultList(e, app, templ, "Error finding active prompt: "+err.Error())
+			return defaultList(e, app, templ, err.Error())
 		}
 
 		// Update the last battle time before running the battle
@@ -217,6 +251,81 @@ func RunBattle(
 	}
 }
 
+// Challenge runs the active prompt against the active prompt of the chosen user
+// or, for unrated sparring, against another prompt of the same user.
+func Challenge(
+	app *pocketbase.PocketBase, templ *template.Template,
+) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		userId := e.Auth.Id
+		limitError := checkBattleLimit(userId)
+		if limitError != nil {
+			return defaultList(e, app, templ, limitError.Error())
+		}
+
+		activePrompt, err := findActivePrompt(app, userId)
+		if err != nil {
+			return defaultList(e, app, templ, err.Error())
+		}
+
+		rated := e.Request.FormValue("unrated") == ""
+		var opponentPrompt *core.Record
+		if promptID := e.Request.FormValue("prompt"); promptID != "" {
+			rated = false
+			opponentPrompt, err = app.FindFirstRecordByFilter(
+				"prompt", "id = {:id} && user = {:user} && status = 'done'",
+				dbx.Params{"id": promptID, "user": userId},
+			)
+			if err != nil {
+				return defaultList(e, app, templ, "Prompt not found")
+			}
+			if opponentPrompt.Id == activePrompt.Id {
+				return defaultList(e, app, templ, "Please choose a prompt other than the active one")
+			}
+		} else {
+			opponentID := e.Request.FormValue("opponent")
+			if opponentID == userId {
+				return defaultList(e, app, templ, "You can't challenge yourself, use sparring instead")
+			}
+			opponentPrompt, err = app.FindFirstRecordByFilter(
+				"prompt", "user = {:user} && active = true",
+				dbx.Params{"user": opponentID},
+			)
+			if err != nil {
+				return defaultList(e, app, templ, "Opponent doesn't have an active prompt")
+			}
+		}
+
+		lastBattleTime[userId] = time.Now()
+
+		result, err := battler.PlayBattle(app, activePrompt, opponentPrompt, rated)
+		if err != nil {
+			return defaultList(e, app, templ, err.Error())
+		}
+
+		return e.Redirect(http.StatusFound, "/battle/"+result.Id)
+	}
+}
+
+func findActivePrompt(app *pocketbase.PocketBase, userId string) (*core.Record, error) {
+	activePrompt, err := app.FindFirstRecordByFilter(
+		"prompt",
+		"user = {:user} && active = true",
+		dbx.Params{
+			"user": userId,
+		},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New(
+			"You don't have an active prompt. Please activate a prompt before starting a battle.",
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error finding active prompt: %w", err)
+	}
+	return activePrompt, nil
+}
+
 func checkBattleLimit(userId string) error {
 	if lastTime, exists := lastBattleTime[userId]; exists {
 		elapsed := time.Since(lastTime)
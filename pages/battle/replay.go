@@ -0,0 +1,120 @@
+package battle
+
+import (
+	"aibattle/battler"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// total size of the cached replay downloads
+const replayCacheBytes = 32 << 20
+
+// replayCache keeps gzipped JSON of recent replays by the replay file name,
+// the oldest entries are dropped first. Files of stored battles never change.
+type replayCache struct {
+	mu    sync.Mutex
+	size  int
+	names []string
+	data  map[string][]byte
+}
+
+var replays = &replayCache{data: make(map[string][]byte)}
+
+func (c *replayCache) get(name string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.data[name]
+	return data, ok
+}
+
+func (c *replayCache) add(name string, data []byte) {
+	if len(data) > replayCacheBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.data[name]; ok {
+		return
+	}
+	for c.size+len(data) > replayCacheBytes {
+		oldest := c.names[0]
+		c.names = c.names[1:]
+		c.size -= len(c.data[oldest])
+		delete(c.data, oldest)
+	}
+	c.names = append(c.names, name)
+	c.data[name] = data
+	c.size += len(data)
+}
+
+// replayJSON returns the battle result as gzipped JSON. Replay files are
+// encoded once, battles stored before replay files are encoded on every
+// request.
+func replayJSON(app core.App, battle *core.Record) ([]byte, error) {
+	name := battle.GetString("replay")
+	if name != "" {
+		if data, ok := replays.get(name); ok {
+			return data, nil
+		}
+	}
+
+	result, err := battler.LoadBattle(app, battle)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	if err := json.NewEncoder(gz).Encode(result); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if name != "" {
+		replays.add(name, b.Bytes())
+	}
+	return b.Bytes(), nil
+}
+
+// Replay serves the battle result as gzipped JSON. A stored battle never
+// changes, so the response can be cached and downloaded in ranges.
+func Replay(app *pocketbase.PocketBase) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		battleResult, err := app.FindRecordById("battle_result", e.Request.PathValue("id"))
+		if err != nil {
+			return e.NotFoundError("battle not found", err)
+		}
+		battle, err := app.FindRecordById("battle", battleResult.GetString("battle"))
+		if err != nil {
+			return e.NotFoundError("battle not found", err)
+		}
+
+		etag := fmt.Sprintf(`"%s-%s"`, battle.Id, battle.GetString("replay"))
+		e.Response.Header().Set("ETag", etag)
+		e.Response.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+		if e.Request.Header.Get("If-None-Match") == etag {
+			return e.NoContent(http.StatusNotModified)
+		}
+
+		data, err := replayJSON(app, battle)
+		if err != nil {
+			return err
+		}
+
+		name := fmt.Sprintf("battle-%s.json.gz", battle.Id)
+		e.Response.Header().Set("Content-Type", "application/gzip")
+		e.Response.Header().Set("Content-Disposition", "attachment; filename="+name)
+		http.ServeContent(
+			e.Response, e.Request, name, battle.GetDateTime("created").Time(),
+			bytes.NewReader(data),
+		)
+		return nil
+	}
+}
@@ -0,0 +1,26 @@
+package battle
+
+import (
+	"aibattle/battler"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Verify replays the battle and returns the verification as JSON, it is
+// available for superusers only.
+func Verify(app *pocketbase.PocketBase) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		verification, err := battler.VerifyBattle(app, e.Request.PathValue("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return e.NotFoundError("battle not found", err)
+		}
+		if err != nil {
+			return err
+		}
+		return e.JSON(http.StatusOK, verification)
+	}
+}
@@ -0,0 +1,276 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/parser"
+	"github.com/dop251/goja/token"
+)
+
+const (
+	// MaxCodeSize is the largest accepted code in bytes, the prompt output
+	// field has the same limit.
+	MaxCodeSize = 30000
+	// source length of string, template and regexp literals
+	maxLiteralLength = 2000
+	// elements of array and object literals
+	maxLiteralElements = 500
+)
+
+// Finding is a construct of the generated code rejected before it runs.
+type Finding struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+}
+
+func (f Finding) String() string {
+	if f.Line == 0 {
+		return f.Message
+	}
+	return fmt.Sprintf("line %d:%d: %s", f.Line, f.Column, f.Message)
+}
+
+// Findings of the analysis, the code is accepted when there are none.
+type Findings []Finding
+
+func (f Findings) Err() error {
+	if len(f) == 0 {
+		return nil
+	}
+	messages := make([]string, len(f))
+	for i, finding := range f {
+		messages[i] = finding.String()
+	}
+	return fmt.Errorf("static analysis failed: %s", strings.Join(messages, "; "))
+}
+
+// forbidden names run code from strings and escape the analysis, constructor
+// leads to the Function constructor from any function
+var forbiddenNames = map[string]string{
+	"eval":        "eval is not allowed",
+	"Function":    "the Function constructor is not allowed",
+	"constructor": "access to constructor is not allowed",
+}
+
+// AnalyzeCode parses the JavaScript code with the goja parser and reports
+// forbidden constructs, loops without a condition or exit, and oversize
+// literals. The forbidden names are found as identifiers, properties and
+// computed keys built from string literals, keys built from strings at
+// runtime are rejected because they can hide the names. Keys taken from
+// variables can't be checked, the QuickJS limits still apply to such code.
+func AnalyzeCode(code string) Findings {
+	var findings Findings
+	if len(code) > MaxCodeSize {
+		findings = append(
+			findings, Finding{
+				Rule:    "size",
+				Message: fmt.Sprintf("the code has %d bytes, the limit is %d", len(code), MaxCodeSize),
+			},
+		)
+	}
+
+	var files file.FileSet
+	program, err := parser.ParseFile(&files, "bot.js", code, 0)
+	if err != nil {
+		// errors after the first one are usually caused by it
+		var list parser.ErrorList
+		if !errors.As(err, &list) || len(list) == 0 {
+			return append(findings, Finding{Rule: "syntax", Message: err.Error()})
+		}
+		return append(
+			findings, Finding{
+				Rule:    "syntax",
+				Message: list[0].Message,
+				Line:    list[0].Position.Line,
+				Column:  list[0].Position.Column,
+			},
+		)
+	}
+
+	add := func(node ast.Node, rule string, message string) {
+		position := files.Position(node.Idx0())
+		findings = append(
+			findings, Finding{Rule: rule, Message: message, Line: position.Line, Column: position.Column},
+		)
+	}
+	walk(
+		reflect.ValueOf(program), func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.Identifier:
+				// constructor is a valid variable name, only its property is forbidden
+				if message, ok := forbiddenNames[node.Name.String()]; ok && node.Name != "constructor" {
+					add(node, "forbidden", message)
+				}
+			case *ast.DotExpression:
+				if message, ok := forbiddenNames[node.Identifier.Name.String()]; ok {
+					add(node, "forbidden", message)
+				}
+			case *ast.BracketExpression:
+				if key, ok := constantString(node.Member); ok {
+					if message, ok := forbiddenNames[key]; ok {
+						add(node, "forbidden", message)
+					}
+				} else if buildsString(node.Member) {
+					add(node, "forbidden", "computed keys built from strings are not allowed")
+				}
+			case *ast.WhileStatement:
+				if infinite(node.Test) && !canExit(node.Body, true) {
+					add(node, "loop", "the while loop never ends")
+				}
+			case *ast.DoWhileStatement:
+				if infinite(node.Test) && !canExit(node.Body, true) {
+					add(node, "loop", "the do-while loop never ends")
+				}
+			case *ast.ForStatement:
+				if infinite(node.Test) && !canExit(node.Body, true) {
+					add(node, "loop", "the for loop never ends")
+				}
+			case *ast.StringLiteral:
+				checkLength(node, node.Literal, add)
+			case *ast.TemplateElement:
+				checkLength(node, node.Literal, add)
+			case *ast.RegExpLiteral:
+				checkLength(node, node.Literal, add)
+			case *ast.ArrayLiteral:
+				checkElements(node, len(node.Value), add)
+			case *ast.ObjectLiteral:
+				checkElements(node, len(node.Value), add)
+			}
+			return true
+		},
+	)
+	return findings
+}
+
+func checkLength(node ast.Node, literal string, add func(ast.Node, string, string)) {
+	if len(literal) > maxLiteralLength {
+		add(
+			node, "literal",
+			fmt.Sprintf("the literal has %d characters, the limit is %d", len(literal), maxLiteralLength),
+		)
+	}
+}
+
+func checkElements(node ast.Node, elements int, add func(ast.Node, string, string)) {
+	if elements > maxLiteralElements {
+		add(
+			node, "literal",
+			fmt.Sprintf("the literal has %d elements, the limit is %d", elements, maxLiteralElements),
+		)
+	}
+}
+
+// constantString evaluates string literals, templates without substitutions
+// and their concatenations.
+func constantString(expr ast.Expression) (string, bool) {
+	switch expr := expr.(type) {
+	case *ast.StringLiteral:
+		return expr.Value.String(), true
+	case *ast.TemplateLiteral:
+		if expr.Tag == nil && len(expr.Expressions) == 0 && len(expr.Elements) == 1 {
+			return expr.Elements[0].Parsed.String(), true
+		}
+	case *ast.BinaryExpression:
+		if expr.Operator == token.PLUS {
+			left, ok := constantString(expr.Left)
+			if !ok {
+				return "", false
+			}
+			right, ok := constantString(expr.Right)
+			return left + right, ok
+		}
+	}
+	return "", false
+}
+
+// buildsString reports whether the key is a template or a concatenation with
+// a string, like "ev" + name.
+func buildsString(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.StringLiteral, *ast.TemplateLiteral:
+		return true
+	case *ast.BinaryExpression:
+		return expr.Operator == token.PLUS && (buildsString(expr.Left) || buildsString(expr.Right))
+	}
+	return false
+}
+
+// infinite reports whether the loop condition is missing or always true.
+func infinite(test ast.Expression) bool {
+	switch test := test.(type) {
+	case nil:
+		return true
+	case *ast.BooleanLiteral:
+		return test.Value
+	case *ast.NumberLiteral:
+		return test.Literal != "0"
+	}
+	return false
+}
+
+// canExit reports whether the loop body contains a return, a throw or a break
+// out of the loop. Functions inside don't count, breaks inside nested loops
+// and switches only count with a label.
+func canExit(body ast.Node, breaks bool) bool {
+	exits := false
+	walk(
+		reflect.ValueOf(body), func(node ast.Node) bool {
+			if exits {
+				return false
+			}
+			switch node := node.(type) {
+			case *ast.FunctionLiteral, *ast.ArrowFunctionLiteral, *ast.ClassLiteral:
+				return false
+			case *ast.ReturnStatement, *ast.ThrowStatement:
+				exits = true
+			case *ast.BranchStatement:
+				exits = node.Label != nil || (breaks && node.Token == token.BREAK)
+			case *ast.ForStatement, *ast.ForInStatement, *ast.ForOfStatement,
+				*ast.WhileStatement, *ast.DoWhileStatement, *ast.SwitchStatement:
+				if node != body {
+					exits = canExit(node, false)
+					return false
+				}
+			}
+			return !exits
+		},
+	)
+	return exits
+}
+
+// walk calls visit for the nodes under the value in source order, children
+// are skipped when visit returns false.
+func walk(value reflect.Value, visit func(node ast.Node) bool) {
+	switch value.Kind() {
+	case reflect.Interface:
+		walk(value.Elem(), visit)
+	case reflect.Pointer:
+		if value.IsNil() {
+			return
+		}
+		if node, ok := value.Interface().(ast.Node); ok && !visit(node) {
+			return
+		}
+		walk(value.Elem(), visit)
+	case reflect.Struct:
+		for i := range value.NumField() {
+			field := value.Type().Field(i)
+			// hoisted declarations repeat the bindings of the body
+			if !field.IsExported() || field.Name == "DeclarationList" {
+				continue
+			}
+			walk(value.Field(i), visit)
+		}
+	case reflect.Slice:
+		for i := range value.Len() {
+			walk(value.Index(i), visit)
+		}
+	}
+}
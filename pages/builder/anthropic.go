@@ -0,0 +1,164 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+)
+
+var anthropicModels = []ModelOption{
+	{
+		ID: anthropic.ModelClaude3_5SonnetLatest, Title: "Claude 3.5 Sonnet",
+		InputPrice: 3, OutputPrice: 15,
+	},
+	{
+		ID: "claude-3-7-sonnet-latest", Title: "Claude 3.7 Sonnet", Thinking: true,
+		InputPrice: 3, OutputPrice: 15,
+	},
+	{
+		ID: anthropic.ModelClaude3_5HaikuLatest, Title: "Claude 3.5 Haiku",
+		InputPrice: 0.8, OutputPrice: 4,
+	},
+}
+
+// submitTool makes the model return the program as structured JSON.
+var submitTool = anthropic.ToolParam{
+	Name:        anthropic.F("submit_bot"),
+	Description: anthropic.F("Submit the code of the bot with its explanation and strategy."),
+	InputSchema: anthropic.F[interface{}](programSchema),
+}
+
+type AnthropicGenerator struct {
+	client *anthropic.Client
+}
+
+func NewAnthropicGenerator() AnthropicGenerator {
+	// defaults to os.LookupEnv("ANTHROPIC_API_KEY")
+	return AnthropicGenerator{client: anthropic.NewClient()}
+}
+
+func (g AnthropicGenerator) Models() []ModelOption {
+	return anthropicModels
+}
+
+func (g AnthropicGenerator) Generate(ctx context.Context, request Request) (string, Usage, error) {
+	messages := make([]anthropic.MessageParam, 0, len(request.Messages))
+	for _, message := range request.Messages {
+		block := anthropic.NewTextBlock(message.Text)
+		if message.Role == RoleAssistant {
+			messages = append(messages, anthropic.NewAssistantMessage(block))
+		} else {
+			messages = append(messages, anthropic.NewUserMessage(block))
+		}
+	}
+
+	model := request.Model
+	if model == "" {
+		model = anthropicModels[0].ID
+	}
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.F(model),
+		MaxTokens: anthropic.Int(maxTokens),
+		System: anthropic.F(
+			[]anthropic.TextBlockParam{
+				anthropic.NewTextBlock(request.System),
+			},
+		),
+		Messages: anthropic.F(messages),
+		Tools:    anthropic.F([]anthropic.ToolParam{submitTool}),
+	}
+	var options []option.RequestOption
+	if request.ThinkingBudget > 0 {
+		// thinking tokens count towards max tokens, temperature can't be changed
+		params.MaxTokens = anthropic.Int(int64(maxTokens + request.ThinkingBudget))
+		// forcing a tool is not supported with thinking, text answers are parsed
+		params.ToolChoice = anthropic.F[anthropic.ToolChoiceUnionParam](
+			anthropic.ToolChoiceAutoParam{Type: anthropic.F(anthropic.ToolChoiceAutoTypeAuto)},
+		)
+		options = append(
+			options, option.WithJSONSet(
+				"thinking", map[string]any{
+					"type":          "enabled",
+					"budget_tokens": request.ThinkingBudget,
+				},
+			),
+		)
+	} else {
+		params.Temperature = anthropic.F(request.Temperature)
+		params.ToolChoice = anthropic.F[anthropic.ToolChoiceUnionParam](
+			anthropic.ToolChoiceToolParam{
+				Name: submitTool.Name,
+				Type: anthropic.F(anthropic.ToolChoiceToolTypeTool),
+			},
+		)
+	}
+
+	// thinking deltas are not known to the client, such responses are not streamed
+	if request.OnText == nil || request.ThinkingBudget > 0 {
+		resp, err := g.client.Messages.New(ctx, params, options...)
+		if err != nil {
+			log.Println(err)
+			return "", Usage{}, err
+		}
+		text, err := responseText(resp)
+		request.onText(text)
+		return text, messageUsage(resp), err
+	}
+
+	stream := g.client.Messages.NewStreaming(ctx, params, options...)
+	defer stream.Close()
+	message := anthropic.Message{}
+	for stream.Next() {
+		event := stream.Current()
+		if err := message.Accumulate(event); err != nil {
+			return "", messageUsage(&message), err
+		}
+		if delta, ok := event.AsUnion().(anthropic.ContentBlockDeltaEvent); ok {
+			switch text := delta.Delta.AsUnion().(type) {
+			case anthropic.TextDelta:
+				request.onText(text.Text)
+			case anthropic.InputJSONDelta:
+				request.onText(text.PartialJSON)
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		log.Println(err)
+		return "", messageUsage(&message), err
+	}
+	text, err := responseText(&message)
+	return text, messageUsage(&message), err
+}
+
+func messageUsage(message *anthropic.Message) Usage {
+	if message == nil {
+		return Usage{}
+	}
+	return Usage{
+		InputTokens:  int(message.Usage.InputTokens),
+		OutputTokens: int(message.Usage.OutputTokens),
+	}
+}
+
+func responseText(resp *anthropic.Message) (string, error) {
+	if resp == nil {
+		return "", errors.New("empty response from the model")
+	}
+	// the submitted program is returned as JSON for ParseResponse
+	for _, block := range resp.Content {
+		if block.Type == anthropic.ContentBlockTypeToolUse && block.Name == submitTool.Name.Value {
+			return string(block.Input), nil
+		}
+	}
+	// thinking blocks come before the answer
+	for _, block := range resp.Content {
+		if block.Type == anthropic.ContentBlockTypeText {
+			log.Printf("%+v\n", block.Text[:min(len(block.Text), 100)])
+			return block.Text, nil
+		}
+	}
+	return "", errors.New("empty response from the model")
+}
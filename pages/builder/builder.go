@@ -6,33 +6,141 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"strings"
+	"slices"
+)
+
+// MaxRepairRounds is how many times failing code is sent back to the model.
+const MaxRepairRounds = 2
 
-	"github.com/anthropics/anthropic-sdk-go"
+// Generation stages reported through Progress, the prompt processor adds the
+// other ones.
+const (
+	StageQueued     = "queued"
+	StageGenerating = "generating"
+	StageValidating = "validating"
+	StageRepairing  = "repairing"
+	StageDone       = "done"
+	StageError      = "error"
 )
 
+// Progress receives stage changes and the response text while it is
+// generated, nil functions are skipped.
+type Progress struct {
+	Stage func(stage string)
+	Text  func(delta string)
+}
+
+func (p Progress) stage(stage string) {
+	if p.Stage != nil {
+		p.Stage(stage)
+	}
+}
+
+// Attempt is one generated program, Error is empty for the accepted one.
+type Attempt struct {
+	Number int
+	Code   string
+	Error  string
+	Usage  Usage
+}
+
+// TotalUsage sums the tokens used by the attempts.
+func TotalUsage(attempts []Attempt) Usage {
+	var usage Usage
+	for _, attempt := range attempts {
+		usage = usage.Add(attempt.Usage)
+	}
+	return usage
+}
+
+// GetProgram generates code for the conversation ending with a user message.
+// Code failing RunCodeTest or the validate check is sent back to the model with
+// the error for a bounded number of repair rounds. Every attempt is returned so
+// the caller can record it.
 func GetProgram(
-	ctx context.Context, prompt string, language string,
-) (string, error) {
+	ctx context.Context, generator CodeGenerator, messages []Message, language string,
+	options GenerationOptions, validate func(code string) error, progress Progress,
+) (Program, []Attempt, error) {
 	gameRules, err := rules.GetGameDescription(language)
 	if err != nil {
-		return "", err
+		return Program{}, nil, err
 	}
-	text, promptErr := GetProgramWithPrompt(ctx, prompt, gameRules)
-	if promptErr != nil {
-		return text, promptErr
+
+	request := Request{
+		GenerationOptions: options,
+		System:            gameRules,
+		Messages:          slices.Clone(messages),
+		OnText:            progress.Text,
+	}
+	var attempts []Attempt
+	for round := 0; ; round++ {
+		if round == 0 {
+			progress.stage(StageGenerating)
+		} else {
+			progress.stage(StageRepairing)
+		}
+		response, usage, err := generator.Generate(ctx, request)
+		if err != nil {
+			return Program{}, attempts, err
+		}
+		progress.stage(StageValidating)
+		program, err := checkResponse(response, language, validate)
+		attempt := Attempt{Number: round + 1, Code: program.Code, Usage: usage}
+		if err == nil {
+			attempts = append(attempts, attempt)
+			return program, attempts, nil
+		}
+		attempt.Error = err.Error()
+		attempts = append(attempts, attempt)
+		log.Printf("Generated code failed, attempt %d: %v", attempt.Number, err)
+		if round == MaxRepairRounds {
+			return program, attempts, err
+		}
+
+		request.Messages = append(
+			request.Messages,
+			Message{Role: RoleAssistant, Text: response},
+			Message{Role: RoleUser, Text: repairMessage(err)},
+		)
+	}
+}
+
+func repairMessage(err error) string {
+	return fmt.Sprintf(
+		"The code failed with the error:\n%s\n\nFix the problem and reply with the whole "+
+			"corrected code in the same format as before.", err,
+	)
+}
+
+// checkResponse extracts the program from the model response and tests it.
+func checkResponse(
+	response string, language string, validate func(code string) error,
+) (Program, error) {
+	program, err := ParseResponse(response)
+	if err != nil {
+		return program, err
+	}
+	if language == rules.LangJS {
+		if err := AnalyzeCode(program.Code).Err(); err != nil {
+			return program, err
+		}
 	}
 
 	// Get the generated code
-	generatedCode, err := rules.AddGeneratedCodeToTheGameTemplate(text, language)
+	generatedCode, err := rules.AddGeneratedCodeToTheGameTemplate(program.Code, language)
 	if err != nil {
-		return text, err
+		return program, err
 	}
 	err = RunCodeTest(generatedCode)
 	if err != nil {
-		return text, err
+		return program, err
 	}
-	return text, nil
+	if validate != nil {
+		if err := validate(program.Code); err != nil {
+			return program, err
+		}
+	}
+	return program, nil
 }
 
 func RunCodeTest(generatedCode string) error {
@@ -43,6 +151,7 @@ func RunCodeTest(generatedCode string) error {
 		log.Printf("Error preparing js function: %v", err)
 		return fmt.Errorf("error preparing js function: %w", err)
 	}
+	defer runner.Close()
 
 	action, err := runner.GetNextAction(
 		gameState, 1, "FirstAction",
@@ -56,51 +165,3 @@ func RunCodeTest(generatedCode string) error {
 	)
 	return nil
 }
-
-func GetProgramWithPrompt(
-	ctx context.Context, prompt string, rules string,
-) (string, error) {
-	messages := []anthropic.MessageParam{
-		anthropic.NewUserMessage(anthropic.NewTextBlock(prompt)),
-	}
-	// defaults to os.LookupEnv("ANTHROPIC_API_KEY")
-	client := anthropic.NewClient()
-	resp, err := client.Messages.New(
-		ctx, anthropic.MessageNewParams{
-			Model:     anthropic.F(anthropic.ModelClaude3_5SonnetLatest),
-			MaxTokens: anthropic.Int(8192),
-			System: anthropic.F(
-				[]anthropic.TextBlockParam{
-					anthropic.NewTextBlock(rules),
-				},
-			),
-			Messages: anthropic.F(messages),
-		},
-	)
-	if err != nil || resp == nil {
-		log.Println(err)
-		return "", err
-	}
-	text := resp.Content[0].Text
-	log.Printf("%+v\n", text[:100])
-	startTag := "<sourcecode>"
-	endTag := "</sourcecode>"
-	text, err = getContentBetweenTags(text, startTag, endTag)
-	if err != nil {
-		return "", err
-	}
-	return text, nil
-}
-
-func getContentBetweenTags(content, startTag, endTag string) (string, error) {
-	startIdx := strings.LastIndex(content, startTag) + len(startTag)
-	endIdx := strings.LastIndex(content, endTag)
-	if startIdx == -1 || endIdx == -1 {
-		return "", fmt.Errorf("tags not found: %s, %s", startTag, endTag)
-	}
-	tagText := content[startIdx:endIdx]
-	if len(tagText) == 0 {
-		return "", fmt.Errorf("text between tags are empty")
-	}
-	return tagText, nil
-}
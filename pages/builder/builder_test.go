@@ -0,0 +1,346 @@
+package builder
+
+import (
+	"aibattle/game/bots"
+	"aibattle/game/rules"
+	"aibattle/game/world"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chdirToRoot lets the rules load their templates relative to the module.
+func chdirToRoot(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir("../.."))
+	t.Cleanup(
+		func() {
+			_ = os.Chdir(wd)
+		},
+	)
+}
+
+func TestGetProgramRepairsCode(t *testing.T) {
+	chdirToRoot(t)
+	code, err := bots.GetCode(bots.Rush)
+	require.NoError(t, err)
+	generator := NewFakeGeneratorWithResponses(
+		"no code here",
+		"<sourcecode>function GetTurnActions() { throw new Error('boom'); }</sourcecode>",
+		"<strategy>Rush the enemy</strategy><sourcecode>"+code+"</sourcecode>",
+	)
+
+	var stages []string
+	var text strings.Builder
+	progress := Progress{
+		Stage: func(stage string) { stages = append(stages, stage) },
+		Text:  func(delta string) { text.WriteString(delta) },
+	}
+	program, attempts, err := GetProgram(
+		context.Background(), generator, []Message{{Role: RoleUser, Text: "rush"}}, rules.LangJS,
+		GenerationOptions{}, nil, progress,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(code), program.Code)
+	assert.Equal(t, "Rush the enemy", program.Strategy)
+	assert.Equal(
+		t, []string{
+			StageGenerating, StageValidating, StageRepairing, StageValidating,
+			StageRepairing, StageValidating,
+		}, stages,
+	)
+	assert.True(t, strings.HasSuffix(text.String(), "<sourcecode>"+code+"</sourcecode>"))
+	require.Len(t, attempts, 3)
+	assert.NotEmpty(t, attempts[0].Error)
+	assert.Contains(t, attempts[1].Error, "boom")
+	assert.Empty(t, attempts[2].Error)
+	assert.Positive(t, attempts[2].Usage.OutputTokens)
+	assert.Greater(t, attempts[2].Usage.InputTokens, attempts[0].Usage.InputTokens)
+
+	requests := generator.Requests()
+	require.Len(t, requests, 3)
+	last := requests[2].Messages
+	require.Len(t, last, 5)
+	assert.Equal(t, RoleUser, last[4].Role)
+	assert.Contains(t, last[4].Text, "boom")
+}
+
+func TestQuickJSRunnerInterrupted(t *testing.T) {
+	tests := []struct {
+		name        string
+		code        string
+		interrupted bool
+	}{
+		{
+			name:        "endless loop",
+			code:        "function GetTurnActions() { while (true) {} }",
+			interrupted: true,
+		},
+		{
+			name: "error mentioning the interrupt",
+			code: `function GetTurnActions() { throw new Error("interrupted"); }`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				runner, err := NewQuickJSRunner(test.code)
+				require.NoError(t, err)
+				defer runner.Close()
+				_, err = runner.GetNextAction(world.GameState{}, 1, "0")
+				require.Error(t, err)
+				assert.Equal(t, test.interrupted, errors.Is(err, ErrInterrupted))
+			},
+		)
+	}
+}
+
+func TestGetProgramGivesUp(t *testing.T) {
+	chdirToRoot(t)
+	generator := NewFakeGenerator("function GetTurnActions() { throw new Error('boom'); }")
+
+	_, attempts, err := GetProgram(
+		context.Background(), generator, []Message{{Role: RoleUser, Text: "rush"}}, rules.LangJS,
+		GenerationOptions{}, nil, Progress{},
+	)
+	assert.ErrorContains(t, err, "boom")
+	assert.Len(t, attempts, MaxRepairRounds+1)
+}
+
+func TestOpenAIGenerator(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+				assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+				var request openAIRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+				assert.Equal(t, "local", request.Model)
+				assert.Equal(t, 0.5, request.Temperature)
+				assert.Equal(t, []openAIMessage{{"system", "rules"}, {"user", "prompt"}}, request.Messages)
+				_, _ = w.Write(
+					[]byte(
+						`{"choices":[{"message":{"role":"assistant","content":"answer"}}],` +
+							`"usage":{"prompt_tokens":12,"completion_tokens":3}}`,
+					),
+				)
+			},
+		),
+	)
+	defer server.Close()
+
+	generator := NewOpenAIGenerator(server.URL+"/v1/", "secret", "local", "other")
+	text, usage, err := generator.Generate(
+		context.Background(),
+		Request{
+			GenerationOptions: GenerationOptions{Temperature: 0.5},
+			System:            "rules",
+			Messages:          []Message{{Role: RoleUser, Text: "prompt"}},
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "answer", text)
+	assert.Equal(t, Usage{InputTokens: 12, OutputTokens: 3}, usage)
+}
+
+func TestOpenAIGeneratorStream(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				var request openAIRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+				assert.True(t, request.Stream)
+				require.NotNil(t, request.StreamOptions)
+				assert.True(t, request.StreamOptions.IncludeUsage)
+				w.Header().Set("Content-Type", "text/event-stream")
+				_, _ = w.Write(
+					[]byte(
+						"data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"ans\"}}]}\n\n" +
+							"data: {\"choices\":[{\"delta\":{\"content\":\"wer\"}}]}\n\n" +
+							"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":2}}\n\n" +
+							"data: [DONE]\n\n",
+					),
+				)
+			},
+		),
+	)
+	defer server.Close()
+
+	var deltas []string
+	generator := NewOpenAIGenerator(server.URL, "", "local")
+	text, usage, err := generator.Generate(
+		context.Background(),
+		Request{
+			Messages: []Message{{Role: RoleUser, Text: "prompt"}},
+			OnText:   func(delta string) { deltas = append(deltas, delta) },
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "answer", text)
+	assert.Equal(t, []string{"ans", "wer"}, deltas)
+	assert.Equal(t, Usage{InputTokens: 5, OutputTokens: 2}, usage)
+}
+
+func TestCheckOptions(t *testing.T) {
+	generator := NewAnthropicGenerator()
+	assert.NoError(t, CheckOptions(generator, GenerationOptions{Model: anthropicModels[0].ID}))
+	assert.NoError(
+		t, CheckOptions(
+			generator,
+			GenerationOptions{Model: "claude-3-7-sonnet-latest", Temperature: 1, ThinkingBudget: 2000},
+		),
+	)
+	assert.Error(t, CheckOptions(generator, GenerationOptions{Model: "gpt"}))
+	assert.Error(t, CheckOptions(generator, GenerationOptions{Model: anthropicModels[0].ID, Temperature: 2}))
+	assert.Error(
+		t, CheckOptions(generator, GenerationOptions{Model: anthropicModels[0].ID, ThinkingBudget: 2000}),
+	)
+	assert.Error(
+		t, CheckOptions(generator, GenerationOptions{Model: "claude-3-7-sonnet-latest", ThinkingBudget: 10}),
+	)
+}
+
+func TestParseResponse(t *testing.T) {
+	code := "function GetTurnActions() { return []; }"
+	tests := []struct {
+		name     string
+		response string
+		want     Program
+		err      string
+	}{
+		{
+			name:     "tags",
+			response: "<strategy>Rush</strategy>\n<explanation>Moves</explanation>\n<sourcecode>\n" + code + "\n</sourcecode>",
+			want:     Program{Code: code, Strategy: "Rush", Explanation: "Moves"},
+		},
+		{
+			name:     "fence inside tags",
+			response: "<sourcecode>\n```javascript\n" + code + "\n```\n</sourcecode>",
+			want:     Program{Code: code},
+		},
+		{
+			name:     "tags mentioned before the code",
+			response: "I put the code in <sourcecode> tags.\n<sourcecode>" + code + "</sourcecode>",
+			want:     Program{Code: code},
+		},
+		{
+			name:     "fence without tags",
+			response: "Here is the bot:\n```js\nconst a = 1;\n```\n```js\n" + code + "\n```",
+			want:     Program{Code: code},
+		},
+		{
+			name:     "structured output",
+			response: `{"code": "` + code + `", "explanation": "Moves", "strategy": "Rush"}`,
+			want:     Program{Code: code, Strategy: "Rush", Explanation: "Moves"},
+		},
+		{
+			name:     "fenced json",
+			response: "```json\n{\"code\": \"" + code + "\", \"strategy\": \"Rush\"}\n```",
+			want:     Program{Code: code, Strategy: "Rush"},
+		},
+		{
+			name:     "cut off",
+			response: "<sourcecode>function GetTurnActions() {",
+			err:      "cut off",
+		},
+		{
+			name:     "no code",
+			response: "I can't help with that.",
+			err:      "tag not found",
+		},
+		{
+			name:     "empty tags",
+			response: "<sourcecode>  </sourcecode>",
+			err:      "empty",
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				program, err := ParseResponse(test.response)
+				if test.err != "" {
+					assert.ErrorContains(t, err, test.err)
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, test.want, program)
+			},
+		)
+	}
+}
+
+func TestAnalyzeCode(t *testing.T) {
+	for _, name := range bots.Names {
+		code, err := bots.GetCode(name)
+		require.NoError(t, err)
+		assert.Empty(t, AnalyzeCode(code), name)
+	}
+
+	tests := []struct {
+		name  string
+		code  string
+		rules []string
+	}{
+		{name: "eval", code: "eval('1 + 1');", rules: []string{"forbidden"}},
+		{name: "function constructor", code: "new Function('return 1')();", rules: []string{"forbidden"}},
+		{name: "constructor access", code: "(() => 1).constructor('return 1')();", rules: []string{"forbidden"}},
+		{name: "constructor by key", code: "[]['constructor'];", rules: []string{"forbidden"}},
+		{name: "concatenated constructor key", code: "f['constr' + 'uctor']('1');", rules: []string{"forbidden"}},
+		{name: "template constructor key", code: "f[`constructor`]('1');", rules: []string{"forbidden"}},
+		{name: "concatenated eval key", code: "globalThis['ev' + 'al']('1');", rules: []string{"forbidden"}},
+		{name: "key built at runtime", code: "f['constr' + x]('1');", rules: []string{"forbidden"}},
+		{name: "template key", code: "f[`${x}uctor`];", rules: []string{"forbidden"}},
+		{name: "eval property", code: "globalThis.eval('1');", rules: []string{"forbidden"}},
+		{name: "index keys", code: "const a = [1, 2]; let i = 0; a[i + 1]; a[0]; a['length'];"},
+		{name: "eval key in object", code: "const a = {eval: 1};"},
+		{name: "endless while", code: "while (true) { let a = 1; }", rules: []string{"loop"}},
+		{name: "endless for", code: "for (;;) { continue; }", rules: []string{"loop"}},
+		{name: "while with break", code: "while (true) { if (Math.random() > 0.5) break; }"},
+		{name: "do-while with return", code: "function f() { do { return 1; } while (1); }"},
+		{
+			name:  "return in nested function",
+			code:  "while (true) { [1].map(() => { return 1; }); }",
+			rules: []string{"loop"},
+		},
+		{
+			name:  "break of nested loop",
+			code:  "while (true) { for (let i = 0; i < 3; i++) { break; } }",
+			rules: []string{"loop"},
+		},
+		{name: "labeled break", code: "outer: while (true) { for (;;) { break outer; } }"},
+		{name: "long string", code: "const a = '" + strings.Repeat("a", 3000) + "';", rules: []string{"literal"}},
+		{
+			name:  "large array",
+			code:  "const a = [" + strings.Repeat("1,", 600) + "];",
+			rules: []string{"literal"},
+		},
+		{name: "code size", code: strings.Repeat("let a0 = 1;\n", 3000)[:MaxCodeSize+1], rules: []string{"size"}},
+		{name: "syntax", code: "function (", rules: []string{"syntax"}},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				findings := AnalyzeCode(test.code)
+				var rules []string
+				for _, finding := range findings {
+					rules = append(rules, finding.Rule)
+				}
+				assert.Equal(t, test.rules, rules)
+				if len(test.rules) == 0 {
+					assert.NoError(t, findings.Err())
+				} else {
+					assert.Error(t, findings.Err())
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,74 @@
+package builder
+
+import (
+	"aibattle/game/bots"
+	"context"
+	"strings"
+	"sync"
+)
+
+// FakeGenerator returns fixture responses without calling a model, every
+// call returns the next response and the last one is repeated.
+type FakeGenerator struct {
+	responses []string
+
+	mu       sync.Mutex
+	requests []Request
+}
+
+// NewFakeGenerator answers with the code wrapped in source code tags.
+func NewFakeGenerator(code ...string) *FakeGenerator {
+	responses := make([]string, len(code))
+	for i, c := range code {
+		responses[i] = "<sourcecode>" + c + "</sourcecode>"
+	}
+	return NewFakeGeneratorWithResponses(responses...)
+}
+
+func NewFakeGeneratorWithResponses(responses ...string) *FakeGenerator {
+	return &FakeGenerator{responses: responses}
+}
+
+// NewReferenceFakeGenerator answers with the rush reference bot.
+func NewReferenceFakeGenerator() (*FakeGenerator, error) {
+	code, err := bots.GetCode(bots.Rush)
+	if err != nil {
+		return nil, err
+	}
+	return NewFakeGeneratorWithResponses(
+		"<strategy>Every unit moves to the closest enemy and attacks it.</strategy>\n" +
+			"<sourcecode>" + code + "</sourcecode>",
+	), nil
+}
+
+func (g *FakeGenerator) Models() []ModelOption {
+	return []ModelOption{{ID: GeneratorFake, Title: "Fake", Thinking: true}}
+}
+
+// Generate counts four characters as a token to make the usage realistic.
+func (g *FakeGenerator) Generate(_ context.Context, request Request) (string, Usage, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.requests = append(g.requests, request)
+	usage := Usage{InputTokens: len(request.System) / 4}
+	for _, message := range request.Messages {
+		usage.InputTokens += len(message.Text) / 4
+	}
+	if len(g.responses) == 0 {
+		return "", usage, nil
+	}
+	response := g.responses[min(len(g.requests), len(g.responses))-1]
+	// streamed in lines like a model would
+	for _, line := range strings.SplitAfter(response, "\n") {
+		request.onText(line)
+	}
+	usage.OutputTokens = len(response) / 4
+	return response, usage, nil
+}
+
+// Requests returns the requests received so far.
+func (g *FakeGenerator) Requests() []Request {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]Request(nil), g.requests...)
+}
@@ -0,0 +1,198 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+const (
+	GeneratorAnthropic = "anthropic"
+	GeneratorOpenAI    = "openai"
+	GeneratorFake      = "fake"
+)
+
+// maximum number of tokens in the model response
+const maxTokens = 8192
+
+type Message struct {
+	Role string
+	Text string
+}
+
+const (
+	DefaultTemperature = 1.0
+	// the smallest thinking budget accepted by the API
+	MinThinkingBudget = 1024
+	MaxThinkingBudget = 16000
+)
+
+// ModelOption is a model users can choose for their prompts.
+type ModelOption struct {
+	ID       string
+	Title    string
+	Thinking bool
+	// USD per million tokens, zero when unknown
+	InputPrice  float64
+	OutputPrice float64
+}
+
+// Cost estimates the price of the tokens in USD.
+func (m ModelOption) Cost(usage Usage) float64 {
+	return (float64(usage.InputTokens)*m.InputPrice + float64(usage.OutputTokens)*m.OutputPrice) / 1e6
+}
+
+// Usage is the number of tokens billed for model calls, thinking tokens are
+// output tokens.
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+}
+
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		InputTokens:  u.InputTokens + other.InputTokens,
+		OutputTokens: u.OutputTokens + other.OutputTokens,
+	}
+}
+
+func (u Usage) Total() int {
+	return u.InputTokens + u.OutputTokens
+}
+
+// GenerationOptions are chosen per prompt, an empty model means the default
+// model of the generator.
+type GenerationOptions struct {
+	Model       string
+	Temperature float64
+	// zero disables extended thinking
+	ThinkingBudget int
+}
+
+// Request is the conversation sent to the model, System holds the game rules.
+type Request struct {
+	GenerationOptions
+	System   string
+	Messages []Message
+	// OnText receives parts of the response while it is generated, generators
+	// that can't stream pass the whole response at once.
+	OnText func(delta string)
+}
+
+func (r Request) onText(delta string) {
+	if r.OnText != nil && delta != "" {
+		r.OnText(delta)
+	}
+}
+
+// CodeGenerator returns the model response to the conversation and the tokens
+// it used, the code is extracted from the response by the caller.
+type CodeGenerator interface {
+	Generate(ctx context.Context, request Request) (string, Usage, error)
+	// Models is the allow-list of models, the first one is the default.
+	Models() []ModelOption
+}
+
+// FindModel returns the model of the generator with the id.
+func FindModel(generator CodeGenerator, id string) (ModelOption, bool) {
+	models := generator.Models()
+	index := slices.IndexFunc(
+		models, func(m ModelOption) bool {
+			return m.ID == id
+		},
+	)
+	if index == -1 {
+		return ModelOption{}, false
+	}
+	return models[index], true
+}
+
+// CheckOptions validates options chosen by the user against the generator.
+func CheckOptions(generator CodeGenerator, options GenerationOptions) error {
+	model, ok := FindModel(generator, options.Model)
+	if !ok {
+		return fmt.Errorf("unknown model %s", options.Model)
+	}
+	if options.Temperature < 0 || options.Temperature > 1 {
+		return fmt.Errorf("temperature must be between 0 and 1")
+	}
+	if options.ThinkingBudget == 0 {
+		return nil
+	}
+	if !model.Thinking {
+		return fmt.Errorf("model %s doesn't support thinking", model.Title)
+	}
+	if options.ThinkingBudget < MinThinkingBudget || options.ThinkingBudget > MaxThinkingBudget {
+		return fmt.Errorf(
+			"thinking budget must be between %d and %d tokens", MinThinkingBudget,
+			MaxThinkingBudget,
+		)
+	}
+	return nil
+}
+
+var defaultGenerator struct {
+	once      sync.Once
+	generator CodeGenerator
+	err       error
+}
+
+// DefaultGenerator returns the generator configured by the environment, it is
+// shared by prompt processing and the prompt form.
+func DefaultGenerator() (CodeGenerator, error) {
+	defaultGenerator.once.Do(
+		func() {
+			defaultGenerator.generator, defaultGenerator.err = NewGeneratorFromEnv()
+		},
+	)
+	return defaultGenerator.generator, defaultGenerator.err
+}
+
+// NewGeneratorFromEnv selects the generator with CODE_GENERATOR, Anthropic is
+// used by default.
+//
+//	anthropic - ANTHROPIC_API_KEY
+//	openai    - OPENAI_BASE_URL (OpenAI by default), OPENAI_API_KEY, OPENAI_MODEL
+//	            with a comma separated list of allowed models
+//	fake      - FAKE_GENERATOR_CODE file with the code, a reference bot by default
+func NewGeneratorFromEnv() (CodeGenerator, error) {
+	switch name := os.Getenv("CODE_GENERATOR"); name {
+	case "", GeneratorAnthropic:
+		return NewAnthropicGenerator(), nil
+	case GeneratorOpenAI:
+		baseURL := os.Getenv("OPENAI_BASE_URL")
+		if baseURL == "" {
+			baseURL = defaultOpenAIURL
+		}
+		var models []string
+		for _, model := range strings.Split(os.Getenv("OPENAI_MODEL"), ",") {
+			if model = strings.TrimSpace(model); model != "" {
+				models = append(models, model)
+			}
+		}
+		if len(models) == 0 {
+			return nil, fmt.Errorf("no OPENAI_MODEL set")
+		}
+		return NewOpenAIGenerator(baseURL, os.Getenv("OPENAI_API_KEY"), models...), nil
+	case GeneratorFake:
+		path := os.Getenv("FAKE_GENERATOR_CODE")
+		if path == "" {
+			return NewReferenceFakeGenerator()
+		}
+		code, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return NewFakeGenerator(string(code)), nil
+	default:
+		return nil, fmt.Errorf("unknown code generator %s", name)
+	}
+}
@@ -0,0 +1,181 @@
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultOpenAIURL = "https://api.openai.com/v1"
+
+// OpenAIGenerator calls any server implementing the OpenAI chat completions
+// API, including self-hosted models.
+type OpenAIGenerator struct {
+	baseURL string
+	apiKey  string
+	models  []ModelOption
+	client  *http.Client
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	MaxTokens   int             `json:"max_tokens"`
+	Temperature float64         `json:"temperature"`
+	Stream      bool            `json:"stream,omitempty"`
+	// without it the streamed response has no usage
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u openAIUsage) toUsage() Usage {
+	return Usage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens}
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+	} `json:"choices"`
+	Usage openAIUsage `json:"usage"`
+}
+
+type openAIChunk struct {
+	Choices []struct {
+		Delta openAIMessage `json:"delta"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+// NewOpenAIGenerator allows the listed models, the first one is the default.
+func NewOpenAIGenerator(baseURL string, apiKey string, models ...string) OpenAIGenerator {
+	options := make([]ModelOption, len(models))
+	for i, model := range models {
+		options[i] = ModelOption{ID: model, Title: model}
+	}
+	return OpenAIGenerator{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		models:  options,
+		client:  &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+func (g OpenAIGenerator) Models() []ModelOption {
+	return g.models
+}
+
+// Generate ignores the thinking budget, the chat completions API has no
+// common way to set it.
+func (g OpenAIGenerator) Generate(ctx context.Context, request Request) (string, Usage, error) {
+	model := request.Model
+	if model == "" {
+		model = g.models[0].ID
+	}
+	body := openAIRequest{
+		Model:       model,
+		Messages:    []openAIMessage{{Role: "system", Content: request.System}},
+		MaxTokens:   maxTokens,
+		Temperature: request.Temperature,
+	}
+	if request.OnText != nil {
+		body.Stream = true
+		body.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	for _, message := range request.Messages {
+		body.Messages = append(body.Messages, openAIMessage{Role: message.Role, Content: message.Text})
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", Usage{}, err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, g.baseURL+"/chat/completions", bytes.NewReader(data),
+	)
+	if err != nil {
+		return "", Usage{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+g.apiKey)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", Usage{}, fmt.Errorf("failed to call the model: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", Usage{}, fmt.Errorf("model request failed with %s: %s", resp.Status, message)
+	}
+	if body.Stream {
+		return readOpenAIStream(resp.Body, request)
+	}
+	var response openAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", Usage{}, fmt.Errorf("error decoding model response: %w", err)
+	}
+	usage := response.Usage.toUsage()
+	if len(response.Choices) == 0 {
+		return "", usage, errors.New("empty response from the model")
+	}
+	return response.Choices[0].Message.Content, usage, nil
+}
+
+// readOpenAIStream collects the server-sent chunks of a streamed completion.
+func readOpenAIStream(body io.Reader, request Request) (string, Usage, error) {
+	var text strings.Builder
+	var usage Usage
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk openAIChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", usage, fmt.Errorf("error decoding model response: %w", err)
+		}
+		// sent in the last chunk without choices
+		if chunk.Usage != nil {
+			usage = chunk.Usage.toUsage()
+		}
+		for _, choice := range chunk.Choices {
+			text.WriteString(choice.Delta.Content)
+			request.onText(choice.Delta.Content)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", usage, fmt.Errorf("error reading model response: %w", err)
+	}
+	if text.Len() == 0 {
+		return "", usage, errors.New("empty response from the model")
+	}
+	return text.String(), usage, nil
+}
@@ -3,13 +3,32 @@ package builder
 import (
 	"aibattle/game/world"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/buke/quickjs-go"
 )
 
+// ErrInterrupted is returned when QuickJS stops the code after its execution
+// timeout.
+var ErrInterrupted = errors.New("the code ran out of time")
+
+// the uncatchable error QuickJS throws from the interrupt handler
+const interruptedCause = "InternalError: interrupted"
+
+// jsError wraps the QuickJS exception with ErrInterrupted when it comes from
+// the timeout.
+func jsError(exception error) error {
+	var jsErr *quickjs.Error
+	if errors.As(exception, &jsErr) && jsErr.Cause == interruptedCause {
+		return fmt.Errorf("%w: %w", ErrInterrupted, exception)
+	}
+	return exception
+}
+
 type QuickJSRunner struct {
-	ctx *quickjs.Context
+	runtime quickjs.Runtime
+	ctx     *quickjs.Context
 }
 
 func NewQuickJSRunner(generatedCode string) (QuickJSRunner, error) {
@@ -25,15 +44,28 @@ func NewQuickJSRunner(generatedCode string) (QuickJSRunner, error) {
 	// Execute the generated code
 	result, err := ctx.Eval(generatedCode)
 	if err != nil {
-		return QuickJSRunner{}, fmt.Errorf("failed to run generated code: %w", err)
+		ctx.Close()
+		runtime.Close()
+		return QuickJSRunner{}, fmt.Errorf("failed to run generated code: %w", jsError(err))
 	}
 	defer result.Free()
 
 	return QuickJSRunner{
-		ctx: ctx,
+		runtime: runtime,
+		ctx:     ctx,
 	}, nil
 }
 
+// Close frees the QuickJS runtime, it must be called on the thread the
+// runner was created on.
+func (runner QuickJSRunner) Close() {
+	if runner.ctx == nil {
+		return
+	}
+	runner.ctx.Close()
+	runner.runtime.Close()
+}
+
 func (runner QuickJSRunner) GetNextAction(
 	state world.GameState, unitID int, actionIndex string,
 ) (world.UnitAction, error) {
@@ -64,7 +96,7 @@ func (runner QuickJSRunner) GetNextAction(
 	if result.IsException() {
 		exception := runner.ctx.Exception()
 		return world.UnitAction{}, fmt.Errorf(
-			"exception when calling GetTurnActions: %w", exception,
+			"exception when calling GetTurnActions: %w", jsError(exception),
 		)
 	}
 	defer result.Free()
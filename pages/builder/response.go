@@ -0,0 +1,132 @@
+package builder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Program is the code generated by the model with its description.
+type Program struct {
+	Code        string `json:"code"`
+	Explanation string `json:"explanation"`
+	// one or two sentences shown next to the bot
+	Strategy string `json:"strategy"`
+}
+
+// programSchema is the JSON schema of Program for structured output.
+var programSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"code": map[string]any{
+			"type":        "string",
+			"description": "The whole source code with the GetTurnActions function.",
+		},
+		"explanation": map[string]any{
+			"type":        "string",
+			"description": "Short explanation of how the code works.",
+		},
+		"strategy": map[string]any{
+			"type":        "string",
+			"description": "One or two sentences describing the strategy of the bot.",
+		},
+	},
+	"required": []string{"code", "explanation", "strategy"},
+}
+
+var fencedBlock = regexp.MustCompile("(?s)```[a-zA-Z]*\n(.*?)```")
+
+// ParseResponse extracts the program from a structured response or from text
+// with source code tags. Models often wrap the code in markdown fences or skip
+// the tags, the largest fenced block is taken then.
+func ParseResponse(response string) (Program, error) {
+	text := strings.TrimSpace(response)
+	if program, ok := parseJSONProgram(text); ok {
+		return program, nil
+	}
+
+	program := Program{
+		Strategy:    tagContent(text, "strategy"),
+		Explanation: tagContent(text, "explanation"),
+	}
+	code, err := getContentBetweenTags(text, "<sourcecode>", "</sourcecode>")
+	if err != nil {
+		var found bool
+		code, found = largestFencedBlock(text)
+		if !found {
+			return Program{}, err
+		}
+	}
+	program.Code = stripFences(code)
+	if program.Code == "" {
+		return Program{}, errors.New("the code in the response is empty")
+	}
+	return program, nil
+}
+
+func parseJSONProgram(text string) (Program, bool) {
+	text = stripFences(text)
+	if !strings.HasPrefix(text, "{") {
+		return Program{}, false
+	}
+	var program Program
+	if err := json.Unmarshal([]byte(text), &program); err != nil {
+		return Program{}, false
+	}
+	program.Code = stripFences(program.Code)
+	return program, program.Code != ""
+}
+
+// getContentBetweenTags returns the text after the last start tag up to the
+// following end tag.
+func getContentBetweenTags(content, startTag, endTag string) (string, error) {
+	startIdx := strings.LastIndex(content, startTag)
+	if startIdx == -1 {
+		return "", fmt.Errorf("tag not found: %s", startTag)
+	}
+	startIdx += len(startTag)
+	length := strings.Index(content[startIdx:], endTag)
+	if length == -1 {
+		return "", fmt.Errorf("tag not found: %s, the response may be cut off", endTag)
+	}
+	tagText := content[startIdx : startIdx+length]
+	if len(strings.TrimSpace(tagText)) == 0 {
+		return "", fmt.Errorf("text between tags are empty")
+	}
+	return tagText, nil
+}
+
+func tagContent(content string, name string) string {
+	text, err := getContentBetweenTags(content, "<"+name+">", "</"+name+">")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(text)
+}
+
+func largestFencedBlock(text string) (string, bool) {
+	var largest string
+	for _, match := range fencedBlock.FindAllStringSubmatch(text, -1) {
+		if len(match[1]) > len(largest) {
+			largest = match[1]
+		}
+	}
+	return largest, strings.TrimSpace(largest) != ""
+}
+
+// stripFences removes a markdown fence around the whole text.
+func stripFences(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	if newline := strings.Index(text, "\n"); newline != -1 {
+		text = text[newline+1:]
+	} else {
+		text = ""
+	}
+	text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,65 @@
+package keys
+
+import (
+	"aibattle/apikey"
+	"aibattle/pages"
+	"html/template"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type Data struct {
+	User   *core.Record
+	Keys   []*core.Record
+	Scopes []string
+	// NewKey is shown once right after the key is created
+	NewKey string
+	Error  string
+}
+
+func List(app *pocketbase.PocketBase, templ *template.Template) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		return render(e, app, templ, "", "")
+	}
+}
+
+func Create(app *pocketbase.PocketBase, templ *template.Template) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		key, _, err := apikey.Create(
+			app, e.Auth.Id, e.Request.FormValue("name"), e.Request.FormValue("scope"),
+		)
+		if err != nil {
+			return render(e, app, templ, "", err.Error())
+		}
+		return render(e, app, templ, key, "")
+	}
+}
+
+func Revoke(app *pocketbase.PocketBase) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		if err := apikey.Revoke(app, e.Auth.Id, e.Request.PathValue("id")); err != nil {
+			return e.NotFoundError("key not found", err)
+		}
+		return e.Redirect(http.StatusFound, "/keys")
+	}
+}
+
+func render(
+	e *core.RequestEvent, app *pocketbase.PocketBase, templ *template.Template, newKey string,
+	error string,
+) error {
+	records, err := apikey.List(app, e.Auth.Id)
+	if err != nil {
+		return err
+	}
+	data := &Data{
+		User:   e.Auth,
+		Keys:   records,
+		Scopes: apikey.Scopes,
+		NewKey: newKey,
+		Error:  error,
+	}
+	return pages.Render(e, templ, "keys/keys.gohtml", data)
+}
@@ -2,7 +2,9 @@ package leader
 
 import (
 	"aibattle/pages"
+	promptpage "aibattle/pages/prompt"
 	"html/template"
+	"time"
 
 	"github.com/pocketbase/dbx"
 	"github.com/samber/lo"
@@ -12,8 +14,11 @@ import (
 )
 
 type LeaderData struct {
-	Scores []ScoreEntry
-	User   *core.Record
+	Scores   []ScoreEntry
+	User     *core.Record
+	Seasons  []*core.Record
+	Season   *core.Record
+	Archived bool
 }
 
 type ScoreEntry struct {
@@ -21,73 +26,122 @@ type ScoreEntry struct {
 	UserID   string
 	Score    float64
 	Language string
+	// model writing the active prompt, "code" for hand-written bots
+	Model string
 }
 
 func List(app *pocketbase.PocketBase, templ *template.Template) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
-		// Get scores ordered by score descending
-		var records []*core.Record
-		err := app.RecordQuery("score").
-			Join("LEFT JOIN", "users", dbx.NewExp("users.id = score.user")).
-			OrderBy("score.score DESC").
-			All(&records)
-
+		seasons, selected, err := SelectSeason(app, e.Request.URL.Query().Get("season"))
 		if err != nil {
 			return err
 		}
+		if selected == nil && e.Request.URL.Query().Get("season") != "" {
+			return e.NotFoundError("season not found", nil)
+		}
 
-		// Get active prompts for users
-		var activePrompts []*core.Record
-		err = app.RecordQuery("prompt").
-			AndWhere(dbx.HashExp{"active": true}).
-			All(&activePrompts)
-
+		scores, err := GetScores(app, selected)
 		if err != nil {
 			return err
 		}
 
-		// Map active prompts by user ID
-		activePromptsMap := lo.Associate(
-			activePrompts, func(p *core.Record) (string, *core.Record) {
-				return p.GetString("user"), p
+		data := &LeaderData{
+			Scores:  scores,
+			User:    e.Auth,
+			Seasons: seasons,
+			Season:  selected,
+			Archived: selected != nil &&
+				(selected != seasons[0] || selected.GetDateTime("end").Time().Before(time.Now())),
+		}
+
+		return pages.Render(e, templ, "leader/leader.gohtml", data)
+	}
+}
+
+// SelectSeason returns the started seasons and the one with the given id.
+// Current season is selected by default, finished ones are archived standings.
+// Selected season is nil when the id is unknown or seasons were never used.
+func SelectSeason(app core.App, seasonID string) ([]*core.Record, *core.Record, error) {
+	seasons, err := app.FindRecordsByFilter("season", "started = true", "-start", 0, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if seasonID != "" {
+		selected, _ := lo.Find(
+			seasons, func(s *core.Record) bool {
+				return s.Id == seasonID
 			},
 		)
+		return seasons, selected, nil
+	}
+	if len(seasons) > 0 {
+		return seasons, seasons[0], nil
+	}
+	return seasons, nil, nil
+}
 
-		// Expand opponent relations to get names
-		expErr := app.ExpandRecords(records, []string{"user"}, nil)
-		if len(expErr) > 0 {
-			return lo.Values(expErr)[0]
-		}
+// GetScores returns the season scores ordered by score descending, nil season
+// means scores stored without a season.
+func GetScores(app core.App, selected *core.Record) ([]ScoreEntry, error) {
+	selectedID := ""
+	if selected != nil {
+		selectedID = selected.Id
+	}
 
-		// Build score entries
-		scores := make([]ScoreEntry, 0)
-		for _, record := range records {
-			user := record.ExpandedOne("user")
-			if user != nil {
-				prompt := activePromptsMap[user.Id]
-				lang := lo.TernaryF(
-					prompt != nil, func() string {
-						return prompt.GetString("language")
-					}, func() string {
-						return ""
-					},
-				)
-				scores = append(
-					scores, ScoreEntry{
-						Username: user.GetString("name"),
-						UserID:   user.Id,
-						Score:    record.GetFloat("score"),
-						Language: lang,
-					},
-				)
-			}
-		}
+	var records []*core.Record
+	err := app.RecordQuery("score").
+		Join("LEFT JOIN", "users", dbx.NewExp("users.id = score.user")).
+		AndWhere(dbx.HashExp{"score.season": selectedID}).
+		OrderBy("score.score DESC").
+		All(&records)
 
-		data := &LeaderData{
-			Scores: scores,
-			User:   e.Auth,
-		}
+	if err != nil {
+		return nil, err
+	}
 
-		return pages.Render(e, templ, "leader/leader.gohtml", data)
+	// Get active prompts for users
+	var activePrompts []*core.Record
+	err = app.RecordQuery("prompt").
+		AndWhere(dbx.HashExp{"active": true}).
+		All(&activePrompts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Map active prompts by user ID
+	activePromptsMap := lo.Associate(
+		activePrompts, func(p *core.Record) (string, *core.Record) {
+			return p.GetString("user"), p
+		},
+	)
+
+	// Expand opponent relations to get names
+	expErr := app.ExpandRecords(records, []string{"user"}, nil)
+	if len(expErr) > 0 {
+		return nil, lo.Values(expErr)[0]
+	}
+
+	// Build score entries
+	scores := make([]ScoreEntry, 0)
+	for _, record := range records {
+		user := record.ExpandedOne("user")
+		if user != nil {
+			entry := ScoreEntry{
+				Username: user.GetString("name"),
+				UserID:   user.Id,
+				Score:    record.GetFloat("score"),
+			}
+			if prompt := activePromptsMap[user.Id]; prompt != nil {
+				entry.Language = prompt.GetString("language")
+				entry.Model = prompt.GetString("model")
+				if promptpage.GetKind(prompt) == promptpage.KindCode {
+					entry.Model = promptpage.KindCode
+				}
+			}
+			scores = append(scores, entry)
+		}
 	}
+	return scores, nil
 }
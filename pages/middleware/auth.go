@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"aibattle/apikey"
 	"errors"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/tools/hook"
@@ -12,6 +13,10 @@ func LoadAuthToken() *hook.Handler[*core.RequestEvent] {
 		Id:       "cookie loader",
 		Priority: 0,
 		Func: func(e *core.RequestEvent) error {
+			if key := apikey.FromHeader(e.Request); key != "" {
+				return loadAPIKey(e, key)
+			}
+
 			if e.Auth != nil {
 				return e.Next()
 			}
@@ -38,3 +43,18 @@ func LoadAuthToken() *hook.Handler[*core.RequestEvent] {
 		},
 	}
 }
+
+// loadAPIKey authenticates the key owner, requests outside the key scope are
+// rejected.
+func loadAPIKey(e *core.RequestEvent, key string) error {
+	user, record, err := apikey.Authenticate(e.App, key)
+	if err != nil {
+		return e.UnauthorizedError("invalid API key", err)
+	}
+	if !apikey.Allows(record.GetString("scope"), e.Request.Method, e.Request.Pattern) {
+		return e.ForbiddenError("API key scope does not allow this request", nil)
+	}
+	e.App.Logger().Debug("loadAPIKey success", "record", user.Id, "key", record.Id)
+	e.Auth = user
+	return e.Next()
+}
@@ -0,0 +1,281 @@
+package prompt
+
+import (
+	"aibattle/battler"
+	"aibattle/pages"
+	"aibattle/pages/builder"
+	"aibattle/usage"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// recent battles of the prompt described in a follow-up message
+	summaryBattles = 5
+	// console output of the bot kept in a battle summary
+	maxSummaryLogs = 300
+)
+
+// GetMessages returns the conversation of the prompt with the model in order.
+// A version continuing the conversation of its parent keeps only its own
+// messages numbered after the parent ones, the rest is loaded from the parents.
+func GetMessages(app core.App, prompt *core.Record) ([]*core.Record, error) {
+	var versions [][]*core.Record
+	seen := make(map[string]bool)
+	for version := prompt; !seen[version.Id]; {
+		seen[version.Id] = true
+		records, err := app.FindRecordsByFilter(
+			"prompt_message", "prompt = {:prompt}", "number", 0, 0,
+			dbx.Params{"prompt": version.Id},
+		)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, records)
+		if len(records) == 0 || records[0].GetInt("number") == 1 {
+			break
+		}
+		parentID := version.GetString("parent")
+		if parentID == "" {
+			break
+		}
+		parent, err := app.FindRecordById("prompt", parentID)
+		// the parent was deleted
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		version = parent
+	}
+
+	var messages []*core.Record
+	for i := len(versions) - 1; i >= 0; i-- {
+		messages = append(messages, versions[i]...)
+	}
+	return messages, nil
+}
+
+// nextNumber returns the number of a message added to the conversation.
+func nextNumber(records []*core.Record) int {
+	if len(records) == 0 {
+		return 1
+	}
+	return records[len(records)-1].GetInt("number") + 1
+}
+
+// conversation converts stored messages for the model. A follow-up sent after
+// a failed generation has no answer, consecutive user messages are joined.
+func conversation(records []*core.Record) []builder.Message {
+	var messages []builder.Message
+	for _, record := range records {
+		role := record.GetString("role")
+		text := record.GetString("text")
+		if last := len(messages) - 1; last >= 0 && messages[last].Role == role {
+			messages[last].Text += "\n\n" + text
+			continue
+		}
+		messages = append(messages, builder.Message{Role: role, Text: text})
+	}
+	return messages
+}
+
+// storedMessage is a message saved with a prompt version, the number is its
+// position in the whole conversation.
+type storedMessage struct {
+	number      int
+	role        string
+	instruction string
+	text        string
+}
+
+func addMessage(app core.App, prompt *core.Record, message storedMessage) error {
+	collection, err := app.FindCollectionByNameOrId("prompt_message")
+	if err != nil {
+		return err
+	}
+	record := core.NewRecord(collection)
+	record.Set("prompt", prompt.Id)
+	record.Set("number", message.number)
+	record.Set("role", message.role)
+	record.Set("instruction", message.instruction)
+	record.Set("text", message.text)
+	return app.Save(record)
+}
+
+// loadConversation returns the stored messages to generate the prompt code
+// from, the conversation starts with the prompt text.
+func loadConversation(app core.App, prompt *core.Record) ([]*core.Record, error) {
+	records, err := GetMessages(app, prompt)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		text := prompt.GetString("text")
+		message := storedMessage{number: 1, role: builder.RoleUser, instruction: text, text: text}
+		if err := addMessage(app, prompt, message); err != nil {
+			return nil, err
+		}
+		if records, err = GetMessages(app, prompt); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+func codeMessage(code string) string {
+	return "<sourcecode>" + code + "</sourcecode>"
+}
+
+// FollowUp creates a new version of the prompt continuing its conversation,
+// the version stores only the new message. The message includes the current
+// code unless the model wrote it in the last answer, and summaries of recent
+// battles of the version.
+func FollowUp(
+	app *pocketbase.PocketBase, userID string, prompt *core.Record, instruction string,
+) (*core.Record, []string, error) {
+	var validationErrs []string
+	if GetKind(prompt) != KindLLM {
+		validationErrs = append(validationErrs, "Only prompts generated by the model can be refined")
+	}
+	if prompt.GetString("status") == "" {
+		validationErrs = append(validationErrs, "The prompt is still being generated")
+	}
+	if len(validationErrs) > 0 {
+		return nil, validationErrs, nil
+	}
+
+	history, err := GetMessages(app, prompt)
+	if err != nil {
+		return nil, nil, err
+	}
+	var messages []storedMessage
+	code := prompt.GetString("output")
+	if len(history) == 0 {
+		// prompts generated before conversations were stored
+		text := prompt.GetString("text")
+		messages = append(
+			messages, storedMessage{number: 1, role: builder.RoleUser, instruction: text, text: text},
+		)
+	} else if last := history[len(history)-1]; last.GetString("role") == builder.RoleAssistant &&
+		last.GetString("text") == codeMessage(code) {
+		code = ""
+	}
+	summaries, err := battleSummaries(app, prompt.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	instruction = strings.TrimSpace(instruction)
+	messages = append(
+		messages, storedMessage{
+			number:      nextNumber(history) + len(messages),
+			role:        builder.RoleUser,
+			instruction: instruction,
+			text:        followUpText(instruction, code, summaries),
+		},
+	)
+	data := Data{Kind: KindLLM, Text: instruction, Options: GetOptions(prompt)}
+	return createUpdatePrompt(data, userID, app, prompt, messages)
+}
+
+func followUpText(instruction string, code string, summaries []string) string {
+	var text strings.Builder
+	if code != "" {
+		text.WriteString("This is the current code of the bot:\n" + codeMessage(code) + "\n\n")
+	}
+	if len(summaries) > 0 {
+		text.WriteString("Results of the latest battles of the bot:\n")
+		for _, summary := range summaries {
+			text.WriteString("- " + summary + "\n")
+		}
+		text.WriteString("\n")
+	}
+	text.WriteString(
+		"Change the code following the instruction and reply with the whole code, its " +
+			"explanation and strategy in the output form.\nInstruction: " + instruction,
+	)
+	return text.String()
+}
+
+// battleSummaries describes the latest battles of the prompt in one line each.
+func battleSummaries(app core.App, promptID string) ([]string, error) {
+	results, err := app.FindRecordsByFilter(
+		"battle_result", "prompt = {:prompt}", "-created", summaryBattles, 0,
+		dbx.Params{"prompt": promptID},
+	)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]string, 0, len(results))
+	for _, result := range results {
+		summary := fmt.Sprintf("%s as %s", result.GetString("result"), result.GetString("team"))
+		if opponent, err := app.FindRecordById("users", result.GetString("opponent")); err == nil {
+			summary += " against " + opponent.GetString("name")
+		}
+		battle, err := app.FindRecordById("battle", result.GetString("battle"))
+		if err != nil {
+			summaries = append(summaries, summary)
+			continue
+		}
+		game, err := battler.LoadBattle(app, battle)
+		if err != nil {
+			return nil, err
+		}
+		if len(game.Turns) > 0 {
+			summary += fmt.Sprintf(" after %d turns", game.Turns[len(game.Turns)-1].Turn+1)
+		}
+		logs := game.TeamOneLogs
+		if result.GetString("team") != "teamA" {
+			logs = game.TeamTwoLogs
+		}
+		if logs = strings.TrimSpace(logs); logs != "" {
+			summary += ", console output: " + logs[:min(len(logs), maxSummaryLogs)]
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// checkQuotas returns the exceeded token quota of the user.
+func checkQuotas(app core.App, userID string) []string {
+	if err := usage.CheckQuotas(app, userID, usage.Limits, time.Now()); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
+
+func SendMessage(
+	app *pocketbase.PocketBase, templ *template.Template,
+) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		id := e.Request.PathValue("id")
+		prompt, data, dataErr := defaultData(e.Auth, app, id)
+		if dataErr != nil {
+			return dataErr
+		}
+		if prompt == nil {
+			return e.NotFoundError("Prompt not found", nil)
+		}
+		newPrompt, validationErr, err := FollowUp(
+			app, e.Auth.Id, prompt, e.Request.FormValue("message"),
+		)
+		if err != nil {
+			return err
+		}
+		if validationErr != nil {
+			data.Errors = validationErr
+			return pages.Render(e, templ, "prompt/prompt.gohtml", data)
+		}
+		return e.Redirect(http.StatusFound, "/prompt/"+newPrompt.Id)
+	}
+}
@@ -0,0 +1,206 @@
+package prompt
+
+import (
+	"aibattle/pages/builder"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// text of one attempt kept for pages opened during generation
+	maxStreamedText = 64 * 1024
+	// slow subscribers are dropped, the browser reconnects and gets a snapshot
+	subscriberBuffer = 256
+	heartbeatPeriod  = 30 * time.Second
+)
+
+type progressEvent struct {
+	Name string
+	Data any
+}
+
+type progressState struct {
+	stage string
+	text  strings.Builder
+}
+
+// progressBroker keeps the progress of prompts being generated and passes it
+// to the open prompt pages.
+type progressBroker struct {
+	mu          sync.Mutex
+	states      map[string]*progressState
+	subscribers map[string]map[chan progressEvent]struct{}
+}
+
+var broker = &progressBroker{
+	states:      make(map[string]*progressState),
+	subscribers: make(map[string]map[chan progressEvent]struct{}),
+}
+
+// progress reports the generation of the prompt to its subscribers.
+func progress(promptID string) builder.Progress {
+	return builder.Progress{
+		Stage: func(stage string) { broker.publishStage(promptID, stage) },
+		Text:  func(delta string) { broker.publishText(promptID, delta) },
+	}
+}
+
+func (b *progressBroker) publishStage(promptID string, stage string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if stage == builder.StageDone || stage == builder.StageError {
+		delete(b.states, promptID)
+	} else {
+		state := b.states[promptID]
+		if state == nil {
+			state = &progressState{}
+			b.states[promptID] = state
+		}
+		state.stage = stage
+		// every attempt streams the whole response again
+		if stage == builder.StageGenerating || stage == builder.StageRepairing {
+			state.text.Reset()
+		}
+	}
+	b.send(promptID, progressEvent{Name: "stage", Data: map[string]string{"stage": stage}})
+}
+
+func (b *progressBroker) publishText(promptID string, delta string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if state := b.states[promptID]; state != nil && state.text.Len() < maxStreamedText {
+		state.text.WriteString(delta)
+	}
+	b.send(promptID, progressEvent{Name: "text", Data: map[string]string{"text": delta}})
+}
+
+// send must be called with the lock held.
+func (b *progressBroker) send(promptID string, event progressEvent) {
+	for ch := range b.subscribers[promptID] {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers[promptID], ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns the events describing the current state followed by the
+// channel of new ones.
+func (b *progressBroker) subscribe(promptID string) ([]progressEvent, chan progressEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan progressEvent, subscriberBuffer)
+	if b.subscribers[promptID] == nil {
+		b.subscribers[promptID] = make(map[chan progressEvent]struct{})
+	}
+	b.subscribers[promptID][ch] = struct{}{}
+
+	stage := builder.StageQueued
+	var text string
+	if state := b.states[promptID]; state != nil {
+		stage = state.stage
+		text = state.text.String()
+	}
+	snapshot := []progressEvent{{Name: "stage", Data: map[string]string{"stage": stage}}}
+	if text != "" {
+		snapshot = append(snapshot, progressEvent{Name: "text", Data: map[string]string{"text": text}})
+	}
+	return snapshot, ch
+}
+
+func (b *progressBroker) unsubscribe(promptID string, ch chan progressEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[promptID][ch]; ok {
+		delete(b.subscribers[promptID], ch)
+		close(ch)
+	}
+	if len(b.subscribers[promptID]) == 0 {
+		delete(b.subscribers, promptID)
+	}
+}
+
+// Events streams the generation stages and the model response of the prompt
+// as server-sent events until it's done.
+func Events(app *pocketbase.PocketBase) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		id := e.Request.PathValue("id")
+		// subscribe before reading the status so the final stage can't be missed
+		snapshot, events := broker.subscribe(id)
+		defer broker.unsubscribe(id, events)
+
+		prompt, err := app.FindFirstRecordByFilter(
+			"prompt", "id={:id} && user={:user}",
+			dbx.Params{"id": id, "user": e.Auth.Id},
+		)
+		if err != nil {
+			return e.NotFoundError("Prompt not found", err)
+		}
+
+		e.Response.Header().Set("Content-Type", "text/event-stream")
+		e.Response.Header().Set("Cache-Control", "no-cache")
+		e.Response.Header().Set("X-Accel-Buffering", "no")
+		e.Response.WriteHeader(http.StatusOK)
+
+		if status := prompt.GetString("status"); status != "" {
+			return writeEvent(e, progressEvent{Name: "stage", Data: map[string]string{"stage": status}})
+		}
+		for _, event := range snapshot {
+			if err := writeEvent(e, event); err != nil {
+				return err
+			}
+		}
+
+		heartbeat := time.NewTicker(heartbeatPeriod)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-e.Request.Context().Done():
+				return nil
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(e.Response, ": heartbeat\n\n"); err != nil {
+					return nil
+				}
+				if err := e.Flush(); err != nil {
+					return nil
+				}
+			case event, ok := <-events:
+				if !ok {
+					return nil
+				}
+				if err := writeEvent(e, event); err != nil {
+					return nil
+				}
+				if event.Name == "stage" && isFinalStage(event.Data) {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func isFinalStage(data any) bool {
+	stage := data.(map[string]string)["stage"]
+	return stage == builder.StageDone || stage == builder.StageError
+}
+
+func writeEvent(e *core.RequestEvent, event progressEvent) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(e.Response, "event: %s\ndata: %s\n\n", event.Name, data); err != nil {
+		return err
+	}
+	return e.Flush()
+}
@@ -0,0 +1,99 @@
+package prompt
+
+import (
+	"aibattle/battler"
+	"aibattle/pages"
+	"aibattle/pages/battle"
+	"aibattle/pages/builder"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ImproveFromBattle creates a new version of the prompt asking the model to fix the code of
+// the prompt which played the battle using the battle feedback. Generation
+// options of the old prompt are kept when they are still valid.
+func ImproveFromBattle(
+	app *pocketbase.PocketBase, userID string, battleResult *core.Record,
+) (*core.Record, []string, error) {
+	source, err := app.FindFirstRecordByFilter(
+		"prompt", "id={:id} && user={:user}",
+		dbx.Params{"id": battleResult.GetString("prompt"), "user": userID},
+	)
+	if err != nil {
+		return nil, []string{"The prompt which played the battle doesn't exist anymore"}, nil
+	}
+	feedback, err := battler.LoadFeedback(app, battleResult)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	generator, err := builder.DefaultGenerator()
+	if err != nil {
+		return nil, nil, err
+	}
+	options := builder.GenerationOptions{Temperature: builder.DefaultTemperature}
+	// the model of an old prompt may not be offered anymore
+	if GetKind(source) == KindLLM && builder.CheckOptions(generator, GetOptions(source)) == nil {
+		options = GetOptions(source)
+	}
+	opponent := "the opponent"
+	if user, err := app.FindRecordById("users", battleResult.GetString("opponent")); err == nil {
+		opponent = user.GetString("name")
+	}
+	data := Data{
+		Kind: KindLLM,
+		// fits the prompt text limit, the message sent to the model is longer
+		Text: fmt.Sprintf(
+			"Improve the bot after the battle against %s (%s).", opponent, feedback.Outcome(),
+		),
+		Options: options,
+	}
+	message := storedMessage{
+		number:      1,
+		role:        builder.RoleUser,
+		instruction: data.Text,
+		text:        improveText(source.GetString("output"), feedback),
+	}
+	return createUpdatePrompt(data, userID, app, source, []storedMessage{message})
+}
+
+func improveText(code string, feedback battler.Feedback) string {
+	return "This is the code of a bot:\n" + codeMessage(code) + "\n\n" +
+		"Feedback from its last battle:\n" + feedback.String() + "\n" +
+		"Improve the code to avoid the failed actions and lose fewer units. Reply with the " +
+		"whole code, its explanation and strategy in the output form."
+}
+
+// ImproveBattle creates a new prompt from the code which played the battle and
+// the battle feedback.
+func ImproveBattle(
+	app *pocketbase.PocketBase, templ *template.Template,
+) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		battleResult, err := app.FindFirstRecordByFilter(
+			"battle_result", "id={:id} && user={:user}",
+			dbx.Params{"id": e.Request.PathValue("id"), "user": e.Auth.Id},
+		)
+		if err != nil {
+			return e.NotFoundError("Battle not found", err)
+		}
+		newPrompt, validationErr, err := ImproveFromBattle(app, e.Auth.Id, battleResult)
+		if err != nil {
+			return err
+		}
+		if validationErr != nil {
+			data, err := battle.GetDetailView(app, e)
+			if err != nil {
+				return err
+			}
+			data.Errors = validationErr
+			return pages.Render(e, templ, "battle/battle.gohtml", data)
+		}
+		return e.Redirect(http.StatusFound, "/prompt/"+newPrompt.Id)
+	}
+}
@@ -2,8 +2,11 @@ package prompt
 
 import (
 	"aibattle/battler"
+	"aibattle/game/rules"
 	"aibattle/pages/builder"
+	"aibattle/usage"
 	"context"
+	"fmt"
 	"log"
 
 	"github.com/pocketbase/dbx"
@@ -11,14 +14,71 @@ import (
 	"github.com/pocketbase/pocketbase/core"
 )
 
+const (
+	// limits of the prompt fields, longer texts from the model are cut
+	maxStrategy    = 2000
+	maxExplanation = 10000
+)
+
 func ProcessPrompts(app *pocketbase.PocketBase) {
+	generator, err := builder.DefaultGenerator()
+	if err != nil {
+		log.Fatalf("Error configuring code generator: %v", err)
+	}
 	ScheduleRemainingPrompts(app)
 	for {
 		nextPrompt := <-PromptsToProcess
-		newProg, promptErr := builder.GetProgram(
-			context.Background(), nextPrompt.GetString("text"),
-			nextPrompt.GetString("language"),
-		)
+		var newProg, validated string
+		var program builder.Program
+		var promptErr error
+		validateCode := func(code string) error {
+			validated = code
+			return validate(nextPrompt, code)
+		}
+		if GetKind(nextPrompt) == KindCode {
+			broker.publishStage(nextPrompt.Id, builder.StageValidating)
+			newProg = nextPrompt.GetString("output")
+			promptErr = testCode(newProg, nextPrompt.GetString("language"))
+			if promptErr == nil {
+				promptErr = validateCode(newProg)
+			}
+		} else {
+			var attempts []builder.Attempt
+			records, err := loadConversation(app, nextPrompt)
+			messages := conversation(records)
+			if err != nil {
+				log.Printf("Error loading prompt conversation: %v", err)
+				messages = []builder.Message{{Role: builder.RoleUser, Text: nextPrompt.GetString("text")}}
+			}
+			program, attempts, promptErr = builder.GetProgram(
+				context.Background(), generator, messages,
+				nextPrompt.GetString("language"), GetOptions(nextPrompt), validateCode,
+				progress(nextPrompt.Id),
+			)
+			newProg = program.Code
+			if err := saveAttempts(app, nextPrompt, attempts); err != nil {
+				log.Printf("Error saving prompt attempts: %v", err)
+			}
+			if err := recordUsage(app, generator, nextPrompt, attempts); err != nil {
+				log.Printf("Error saving prompt usage: %v", err)
+			}
+			if promptErr == nil {
+				err := addMessage(
+					app, nextPrompt, storedMessage{
+						number: nextNumber(records),
+						role:   builder.RoleAssistant,
+						text:   codeMessage(newProg),
+					},
+				)
+				if err != nil {
+					log.Printf("Error saving prompt conversation: %v", err)
+				}
+			}
+		}
+		// the report of an earlier repair round doesn't describe the final code
+		if validated != newProg {
+			nextPrompt.Set("validation", nil)
+		}
 		if promptErr != nil {
 			log.Printf("Error getting prompt: %v", promptErr)
 			nextPrompt.Set("status", "error")
@@ -28,16 +88,104 @@ func ProcessPrompts(app *pocketbase.PocketBase) {
 			nextPrompt.Set("error", "")
 		}
 		nextPrompt.Set("output", newProg)
+		nextPrompt.Set("analysis", analyze(newProg, nextPrompt.GetString("language")))
+		nextPrompt.Set("strategy", truncate(program.Strategy, maxStrategy))
+		nextPrompt.Set("explanation", truncate(program.Explanation, maxExplanation))
 		saveErr := app.Save(nextPrompt)
 		if saveErr != nil {
 			log.Printf("Error saving prompt: %v", saveErr)
 		}
+		broker.publishStage(nextPrompt.Id, nextPrompt.GetString("status"))
 		activateIfFirstPrompt(app, nextPrompt)
 	}
 }
 
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length])
+}
+
+// testCode runs the checks generated code passes in builder.GetProgram.
+func testCode(code string, language string) error {
+	if err := analyze(code, language).Err(); err != nil {
+		return err
+	}
+	fullCode, err := rules.AddGeneratedCodeToTheGameTemplate(code, language)
+	if err != nil {
+		return err
+	}
+	return builder.RunCodeTest(fullCode)
+}
+
+// analyze returns the static analysis findings of JavaScript code, other
+// languages are not analyzed.
+func analyze(code string, language string) builder.Findings {
+	if language != rules.LangJS {
+		return nil
+	}
+	return builder.AnalyzeCode(code)
+}
+
+// validate plays validation games with the code and stores the report on the
+// prompt, a rejected bot can't be activated.
+func validate(prompt *core.Record, code string) error {
+	report, err := battler.Validate(code)
+	if err != nil {
+		return fmt.Errorf("error playing validation games: %w", err)
+	}
+	prompt.Set("validation", report)
+	return report.Err()
+}
+
+// saveAttempts replaces attempts of the previous generation of the prompt.
+func saveAttempts(app *pocketbase.PocketBase, prompt *core.Record, attempts []builder.Attempt) error {
+	_, err := app.DB().Delete("prompt_attempt", dbx.HashExp{"prompt": prompt.Id}).Execute()
+	if err != nil {
+		return err
+	}
+	collection, err := app.FindCollectionByNameOrId("prompt_attempt")
+	if err != nil {
+		return err
+	}
+	for _, attempt := range attempts {
+		record := core.NewRecord(collection)
+		record.Set("prompt", prompt.Id)
+		record.Set("number", attempt.Number)
+		record.Set("code", attempt.Code)
+		record.Set("error", attempt.Error)
+		if err := app.Save(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordUsage stores the tokens of all attempts, prices of unknown models are
+// zero.
+func recordUsage(
+	app *pocketbase.PocketBase, generator builder.CodeGenerator, prompt *core.Record,
+	attempts []builder.Attempt,
+) error {
+	tokens := builder.TotalUsage(attempts)
+	if tokens.Total() == 0 {
+		return nil
+	}
+	modelID := prompt.GetString("model")
+	if modelID == "" {
+		modelID = generator.Models()[0].ID
+	}
+	model, ok := builder.FindModel(generator, modelID)
+	if !ok {
+		model = builder.ModelOption{ID: modelID}
+	}
+	return usage.Record(app, prompt, model, tokens)
+}
+
 func activateIfFirstPrompt(app *pocketbase.PocketBase, prompt *core.Record) error {
-	if prompt.GetBool("active") {
+	if prompt.GetBool("active") || prompt.GetString("status") != "done" {
 		return nil
 	}
 	user := prompt.GetString("user")
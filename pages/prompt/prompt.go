@@ -2,11 +2,15 @@ package prompt
 
 import (
 	"aibattle/battler"
+	"aibattle/game/bots"
 	"aibattle/game/rules"
 	"aibattle/pages"
+	"aibattle/pages/builder"
+	"aibattle/season"
 	"fmt"
 	"html/template"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/pocketbase/dbx"
@@ -14,17 +18,40 @@ import (
 	"github.com/pocketbase/pocketbase/core"
 )
 
+const (
+	// KindLLM prompts are turned into code by the model
+	KindLLM = "llm"
+	// KindCode prompts hold hand-written GetTurnActions source
+	KindCode = "code"
+)
+
+const maxTextLength = 300
+
 type Data struct {
 	User *core.Record
 
-	Text   string
-	Errors []string
+	Kind    string
+	Text    string
+	Options builder.GenerationOptions
+	Errors  []string
 
 	ID             string
 	Output         string
+	Strategy       string
+	Explanation    string
 	Status         string
 	DefaultPrompts map[string]string
 	Prompts        []*core.Record
+	Bots           map[string]string
+	Validation     *battler.ValidationReport
+	Analysis       builder.Findings
+	Attempts       []*core.Record
+	Messages       []*core.Record
+	// earlier versions of the prompt, the parent first
+	Versions []*core.Record
+	// tokens used to generate the prompt
+	Usage  *core.Record
+	Models []builder.ModelOption
 }
 
 func GetPrompts(app *pocketbase.PocketBase, userId string) ([]*core.Record, error) {
@@ -61,12 +88,15 @@ func CreatePrompt(
 		if dataErr != nil {
 			return dataErr
 		}
+		data.Kind = e.Request.FormValue("kind")
 		data.Text = e.Request.FormValue("text")
+		data.Options = readOptions(e)
 		newPrompt, validationErr, promptErr := CreateUpdatePrompt(data, e.Auth.Id, app, nil)
 		if promptErr != nil {
 			return promptErr
 		}
 		if validationErr != nil {
+			data.Errors = validationErr
 			return pages.Render(e, templ, "prompt/prompt.gohtml", data)
 		}
 		return e.Redirect(http.StatusFound, "/prompt/"+newPrompt.Id)
@@ -96,21 +126,21 @@ func UpdatePrompt(
 			return dataErr
 		}
 
+		data.Kind = e.Request.FormValue("kind")
 		data.Text = e.Request.FormValue("text")
+		data.Options = readOptions(e)
 
-		updatedPrompt, validationErr, promptErr := CreateUpdatePrompt(
+		newVersion, validationErr, promptErr := CreateUpdatePrompt(
 			data, e.Auth.Id, app, prompt,
 		)
 		if promptErr != nil {
 			return promptErr
 		}
-		// resetting Output field after update
-		if validationErr == nil {
-			data.Output = updatedPrompt.GetString("output")
-			data.Status = updatedPrompt.GetString("status")
+		if validationErr != nil {
+			data.Errors = validationErr
+			return pages.Render(e, templ, "prompt/prompt.gohtml", data)
 		}
-		data.Errors = validationErr
-		return pages.Render(e, templ, "prompt/prompt.gohtml", data)
+		return e.Redirect(http.StatusFound, "/prompt/"+newVersion.Id)
 	}
 }
 
@@ -120,39 +150,47 @@ func ActivatePrompt(
 	app *pocketbase.PocketBase,
 ) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
-		id := e.Request.PathValue("id")
-		prompt, dataErr := app.FindFirstRecordByFilter(
-			"prompt", "id={:id} && user={:user} && status='done'",
-			dbx.Params{"id": id, "user": e.Auth.Id},
-		)
-		if dataErr != nil {
-			return dataErr
-		}
-		// set all other prompts to inactive first
-		_, err := app.DB().NewQuery("UPDATE prompt SET active = FALSE WHERE user = {:user}").
-			Bind(
-				dbx.Params{
-					"user": e.Auth.Id,
-				},
-			).
-			Execute()
+		prompt, err := Activate(app, e.Auth.Id, e.Request.PathValue("id"))
 		if err != nil {
 			return err
 		}
+		return e.Redirect(http.StatusFound, "/prompt/"+prompt.Id)
+	}
+}
 
-		prompt.Set("active", true)
-		saveError := app.Save(prompt)
-		if saveError != nil {
-			return saveError
-		}
+// Activate makes the finished prompt the only active prompt of the user and
+// schedules battles for it.
+func Activate(app *pocketbase.PocketBase, userID string, id string) (*core.Record, error) {
+	prompt, dataErr := app.FindFirstRecordByFilter(
+		"prompt", "id={:id} && user={:user} && status='done'",
+		dbx.Params{"id": id, "user": userID},
+	)
+	if dataErr != nil {
+		return nil, dataErr
+	}
+	// set all other prompts to inactive first
+	_, err := app.DB().NewQuery("UPDATE prompt SET active = FALSE WHERE user = {:user}").
+		Bind(
+			dbx.Params{
+				"user": userID,
+			},
+		).
+		Execute()
+	if err != nil {
+		return nil, err
+	}
 
-		if time.Now().Sub(promptsRunsAfterActivation[e.Auth.Id]) > 3*time.Minute {
-			promptsRunsAfterActivation[e.Auth.Id] = time.Now()
-			battler.BattleChannel <- prompt.Id
-		}
+	prompt.Set("active", true)
+	saveError := app.Save(prompt)
+	if saveError != nil {
+		return nil, saveError
+	}
 
-		return e.Redirect(http.StatusFound, "/prompt/"+prompt.Id)
+	if time.Now().Sub(promptsRunsAfterActivation[userID]) > 3*time.Minute {
+		promptsRunsAfterActivation[userID] = time.Now()
+		battler.BattleChannel <- prompt.Id
 	}
+	return prompt, nil
 }
 
 func getRules() (map[string]string, error) {
@@ -179,11 +217,23 @@ func defaultData(
 	if err != nil {
 		return nil, Data{}, err
 	}
+	generator, err := builder.DefaultGenerator()
+	if err != nil {
+		return nil, Data{}, err
+	}
+	models := generator.Models()
 	data := Data{
 		User:           user,
 		Prompts:        prompts,
 		DefaultPrompts: gameRules,
-		Status:         "unknown",
+		Kind:           KindLLM,
+		Options: builder.GenerationOptions{
+			Model:       models[0].ID,
+			Temperature: builder.DefaultTemperature,
+		},
+		Status: "unknown",
+		Bots:   bots.Titles,
+		Models: models,
 	}
 
 	if id != "" {
@@ -195,8 +245,43 @@ func defaultData(
 			return nil, data, err
 		}
 		data.ID = prompt.Id
+		data.Kind = GetKind(prompt)
 		data.Text = prompt.GetString("text")
 		data.Output = prompt.GetString("output")
+		data.Strategy = prompt.GetString("strategy")
+		data.Explanation = prompt.GetString("explanation")
+		if data.Kind == KindCode {
+			data.Text = data.Output
+		} else {
+			data.Options = GetOptions(prompt)
+		}
+		data.Validation = GetValidation(prompt)
+		data.Analysis = GetAnalysis(prompt)
+		data.Attempts, err = app.FindRecordsByFilter(
+			"prompt_attempt", "prompt = {:prompt}", "number", 0, 0,
+			dbx.Params{"prompt": prompt.Id},
+		)
+		if err != nil {
+			return nil, data, err
+		}
+		data.Messages, err = GetMessages(app, prompt)
+		if err != nil {
+			return nil, data, err
+		}
+		data.Versions, err = GetVersions(app, prompt)
+		if err != nil {
+			return nil, data, err
+		}
+		usages, err := app.FindRecordsByFilter(
+			"usage", "prompt = {:prompt}", "-created", 1, 0,
+			dbx.Params{"prompt": prompt.Id},
+		)
+		if err != nil {
+			return nil, data, err
+		}
+		if len(usages) > 0 {
+			data.Usage = usages[0]
+		}
 		data.Status = prompt.GetString("status")
 		promptError := prompt.GetString("error")
 		if promptError != "" {
@@ -208,17 +293,100 @@ func defaultData(
 	return nil, data, nil
 }
 
+// GetKind returns the prompt kind, prompts created before kinds were
+// generated.
+func GetKind(prompt *core.Record) string {
+	if prompt.GetString("kind") == KindCode {
+		return KindCode
+	}
+	return KindLLM
+}
+
+// GetOptions returns the generation options chosen for the prompt.
+func GetOptions(prompt *core.Record) builder.GenerationOptions {
+	return builder.GenerationOptions{
+		Model:          prompt.GetString("model"),
+		Temperature:    prompt.GetFloat("temperature"),
+		ThinkingBudget: prompt.GetInt("thinking_budget"),
+	}
+}
+
+func readOptions(e *core.RequestEvent) builder.GenerationOptions {
+	options := builder.GenerationOptions{
+		Model:       e.Request.FormValue("model"),
+		Temperature: builder.DefaultTemperature,
+	}
+	if value, err := strconv.ParseFloat(e.Request.FormValue("temperature"), 64); err == nil {
+		options.Temperature = value
+	}
+	options.ThinkingBudget, _ = strconv.Atoi(e.Request.FormValue("thinking_budget"))
+	return options
+}
+
+// GetValidation returns the report of validation games, nil for prompts
+// validated before reports were stored.
+func GetValidation(prompt *core.Record) *battler.ValidationReport {
+	var report battler.ValidationReport
+	if err := prompt.UnmarshalJSONField("validation", &report); err != nil || report.Games == nil {
+		return nil
+	}
+	return &report
+}
+
+// GetAnalysis returns the static analysis findings stored on the prompt.
+func GetAnalysis(prompt *core.Record) builder.Findings {
+	var findings builder.Findings
+	if err := prompt.UnmarshalJSONField("analysis", &findings); err != nil {
+		return nil
+	}
+	return findings
+}
+
 var PromptsToProcess = make(chan *core.Record, 20)
 var UserRateLimiter = make(map[string]time.Time)
 
+// CreateUpdatePrompt saves the prompt and schedules its generation. Prompts
+// are never changed after they are created, an update creates a new version
+// linked to the parent so battles keep pointing at the code which played them.
 func CreateUpdatePrompt(
-	data Data, userID string, app *pocketbase.PocketBase, prompt *core.Record,
+	data Data, userID string, app *pocketbase.PocketBase, parent *core.Record,
+) (*core.Record, []string, error) {
+	return createUpdatePrompt(data, userID, app, parent, nil)
+}
+
+// createUpdatePrompt starts the conversation with the messages instead of the
+// prompt text when they are set.
+func createUpdatePrompt(
+	data Data, userID string, app *pocketbase.PocketBase, parent *core.Record,
+	messages []storedMessage,
 ) (*core.Record, []string, error) {
 	var errors []string
+	if data.Kind == "" {
+		data.Kind = KindLLM
+	}
+	maxLength := maxTextLength
+	switch data.Kind {
+	case KindLLM:
+		generator, err := builder.DefaultGenerator()
+		if err != nil {
+			return nil, nil, err
+		}
+		if data.Options.Model == "" {
+			data.Options.Model = generator.Models()[0].ID
+		}
+		if err := builder.CheckOptions(generator, data.Options); err != nil {
+			errors = append(errors, err.Error())
+		}
+		errors = append(errors, checkQuotas(app, userID)...)
+	case KindCode:
+		maxLength = builder.MaxCodeSize
+	default:
+		errors = append(errors, "Unknown prompt kind")
+	}
 	if len(data.Text) == 0 {
 		errors = append(errors, "Text is empty")
 	}
-	if len(data.Text) > 300 {
+	if len(data.Text) > maxLength {
 		errors = append(errors, "Text too long")
 	}
 	if time.Now().Sub(UserRateLimiter[userID]).Seconds() < 60 {
@@ -228,24 +396,47 @@ func CreateUpdatePrompt(
 		return nil, errors, nil
 	}
 
-	var newPrompt *core.Record
-	if prompt == nil {
-		collection, err := app.FindCollectionByNameOrId("prompt")
-		if err != nil {
-			return nil, nil, err
-		}
-		newPrompt = core.NewRecord(collection)
-	} else {
-		newPrompt = prompt
+	collection, err := app.FindCollectionByNameOrId("prompt")
+	if err != nil {
+		return nil, nil, err
+	}
+	newPrompt := core.NewRecord(collection)
+	if parent != nil {
+		newPrompt.Set("parent", parent.Id)
 	}
-	newPrompt.Set("text", data.Text)
 	newPrompt.Set("user", userID)
+	newPrompt.Set("kind", data.Kind)
 	newPrompt.Set("language", rules.LangJS)
 	newPrompt.Set("status", "")
-	newPrompt.Set("output", "")
-	saveErr := app.Save(newPrompt)
-	if saveErr != nil {
-		return newPrompt, nil, saveErr
+	// code prompts are validated before they can play, the code is kept as output
+	if data.Kind == KindCode {
+		newPrompt.Set("text", "")
+		newPrompt.Set("output", data.Text)
+		data.Options = builder.GenerationOptions{}
+	} else {
+		newPrompt.Set("text", data.Text)
+		newPrompt.Set("output", "")
+	}
+	newPrompt.Set("model", data.Options.Model)
+	newPrompt.Set("temperature", data.Options.Temperature)
+	newPrompt.Set("thinking_budget", data.Options.ThinkingBudget)
+	newPrompt.Set("rating", season.InitialScore)
+	// a prompt without its conversation would wait for generation forever
+	err = app.RunInTransaction(
+		func(txApp core.App) error {
+			if err := txApp.Save(newPrompt); err != nil {
+				return err
+			}
+			for _, message := range messages {
+				if err := addMessage(txApp, newPrompt, message); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	select {
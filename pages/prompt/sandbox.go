@@ -0,0 +1,73 @@
+package prompt
+
+import (
+	"aibattle/battler"
+	"aibattle/game/bots"
+	"aibattle/game/world"
+	"aibattle/pages"
+	"aibattle/pages/battle"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+var (
+	sandboxMu       sync.Mutex
+	sandboxLastRuns = make(map[string]time.Time)
+)
+
+// Sandbox plays the prompt against a reference bot and shows the game in the
+// battle viewer. Nothing is saved, so scores and ratings are not affected.
+func Sandbox(app *pocketbase.PocketBase, templ *template.Template) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		prompt, err := app.FindFirstRecordByFilter(
+			"prompt", "id={:id} && user={:user} && status='done'",
+			dbx.Params{"id": e.Request.PathValue("id"), "user": e.Auth.Id},
+		)
+		if err != nil {
+			return e.NotFoundError("prompt not found", err)
+		}
+
+		botName := e.Request.FormValue("bot")
+		botCode, err := bots.GetCode(botName)
+		if err != nil {
+			return e.BadRequestError(err.Error(), err)
+		}
+
+		sandboxMu.Lock()
+		if time.Since(sandboxLastRuns[e.Auth.Id]) < 10*time.Second {
+			sandboxMu.Unlock()
+			return e.TooManyRequestsError("Please wait a few seconds before the next sandbox game.", nil)
+		}
+		sandboxLastRuns[e.Auth.Id] = time.Now()
+		sandboxMu.Unlock()
+
+		match, err := battler.NewMatch(prompt.GetString("output"), botCode)
+		if err != nil {
+			return err
+		}
+		defer match.Close()
+		result, err := world.RunGame(match.GetTeamNextAction)
+		if err != nil {
+			return fmt.Errorf("error running sandbox game: %w", err)
+		}
+		output, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+
+		data := &battle.DetailView{
+			User:     e.Auth,
+			Output:   string(output),
+			MyTeam:   "teamA",
+			Opponent: bots.Titles[botName],
+		}
+		return pages.Render(e, templ, "battle/battle.gohtml", data)
+	}
+}
@@ -0,0 +1,127 @@
+package prompt
+
+import (
+	"aibattle/pages"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// versions listed on the prompt page
+	maxVersions = 20
+	// unchanged lines shown around a change
+	diffContext = 3
+)
+
+// GetVersions returns the ancestors of the prompt, the parent first.
+func GetVersions(app core.App, prompt *core.Record) ([]*core.Record, error) {
+	var versions []*core.Record
+	seen := map[string]bool{prompt.Id: true}
+	parentID := prompt.GetString("parent")
+	for parentID != "" && !seen[parentID] && len(versions) < maxVersions {
+		parent, err := app.FindFirstRecordByFilter(
+			"prompt", "id={:id} && user={:user}",
+			dbx.Params{"id": parentID, "user": prompt.GetString("user")},
+		)
+		// the parent was deleted
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, parent)
+		seen[parentID] = true
+		parentID = parent.GetString("parent")
+	}
+	return versions, nil
+}
+
+// DiffLine is a line of a unified diff, Kind is hunk, context, add or remove.
+type DiffLine struct {
+	Kind string
+	Text string
+}
+
+// diffLines compares texts line by line, the result is empty for equal texts.
+func diffLines(a string, b string) []DiffLine {
+	linesA := strings.Split(a, "\n")
+	linesB := strings.Split(b, "\n")
+	matcher := difflib.NewMatcher(linesA, linesB)
+	var lines []DiffLine
+	for _, group := range matcher.GetGroupedOpCodes(diffContext) {
+		first, last := group[0], group[len(group)-1]
+		lines = append(
+			lines, DiffLine{
+				Kind: "hunk",
+				Text: fmt.Sprintf(
+					"@@ -%d,%d +%d,%d @@", first.I1+1, last.I2-first.I1, first.J1+1,
+					last.J2-first.J1,
+				),
+			},
+		)
+		for _, code := range group {
+			if code.Tag == 'e' {
+				for _, line := range linesA[code.I1:code.I2] {
+					lines = append(lines, DiffLine{Kind: "context", Text: line})
+				}
+				continue
+			}
+			if code.Tag == 'r' || code.Tag == 'd' {
+				for _, line := range linesA[code.I1:code.I2] {
+					lines = append(lines, DiffLine{Kind: "remove", Text: line})
+				}
+			}
+			if code.Tag == 'r' || code.Tag == 'i' {
+				for _, line := range linesB[code.J1:code.J2] {
+					lines = append(lines, DiffLine{Kind: "add", Text: line})
+				}
+			}
+		}
+	}
+	return lines
+}
+
+type DiffData struct {
+	User     *core.Record
+	Prompt   *core.Record
+	Other    *core.Record
+	TextDiff []DiffLine
+	CodeDiff []DiffLine
+}
+
+// Diff compares the text and the code of two versions of the user's prompts,
+// the other version is the old one.
+func Diff(app *pocketbase.PocketBase, templ *template.Template) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		records := make([]*core.Record, 2)
+		for i, name := range []string{"id", "other"} {
+			record, err := app.FindFirstRecordByFilter(
+				"prompt", "id={:id} && user={:user}",
+				dbx.Params{"id": e.Request.PathValue(name), "user": e.Auth.Id},
+			)
+			if err != nil {
+				return e.NotFoundError("Prompt not found", err)
+			}
+			records[i] = record
+		}
+		prompt, other := records[0], records[1]
+
+		data := DiffData{
+			User:     e.Auth,
+			Prompt:   prompt,
+			Other:    other,
+			TextDiff: diffLines(other.GetString("text"), prompt.GetString("text")),
+			CodeDiff: diffLines(other.GetString("output"), prompt.GetString("output")),
+		}
+		return pages.Render(e, templ, "prompt/diff.gohtml", data)
+	}
+}
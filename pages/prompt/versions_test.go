@@ -0,0 +1,79 @@
+package prompt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected []DiffLine
+	}{
+		{
+			name: "equal texts",
+			a:    "one\ntwo\nthree",
+			b:    "one\ntwo\nthree",
+		},
+		{
+			name: "pure insert",
+			a:    "one\ntwo",
+			b:    "one\nnew\ntwo",
+			expected: []DiffLine{
+				{Kind: "hunk", Text: "@@ -1,2 +1,3 @@"},
+				{Kind: "context", Text: "one"},
+				{Kind: "add", Text: "new"},
+				{Kind: "context", Text: "two"},
+			},
+		},
+		{
+			name: "pure delete",
+			a:    "one\nold\ntwo",
+			b:    "one\ntwo",
+			expected: []DiffLine{
+				{Kind: "hunk", Text: "@@ -1,3 +1,2 @@"},
+				{Kind: "context", Text: "one"},
+				{Kind: "remove", Text: "old"},
+				{Kind: "context", Text: "two"},
+			},
+		},
+		{
+			name: "replace",
+			a:    "one\nold\ntwo",
+			b:    "one\nnew\ntwo",
+			expected: []DiffLine{
+				{Kind: "hunk", Text: "@@ -1,3 +1,3 @@"},
+				{Kind: "context", Text: "one"},
+				{Kind: "remove", Text: "old"},
+				{Kind: "add", Text: "new"},
+				{Kind: "context", Text: "two"},
+			},
+		},
+		{
+			name: "context around the change",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9",
+			b:    "1\n2\n3\n4\nfive\n6\n7\n8\n9",
+			expected: []DiffLine{
+				{Kind: "hunk", Text: "@@ -2,7 +2,7 @@"},
+				{Kind: "context", Text: "2"},
+				{Kind: "context", Text: "3"},
+				{Kind: "context", Text: "4"},
+				{Kind: "remove", Text: "5"},
+				{Kind: "add", Text: "five"},
+				{Kind: "context", Text: "6"},
+				{Kind: "context", Text: "7"},
+				{Kind: "context", Text: "8"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				assert.Equal(t, test.expected, diffLines(test.a, test.b))
+			},
+		)
+	}
+}
@@ -9,7 +9,7 @@ import (
 	"path/filepath"
 )
 
-//go:embed auth/*.gohtml battle/*.gohtml index/*.gohtml layout/*.gohtml leader/*.gohtml prompt/*.gohtml
+//go:embed auth/*.gohtml battle/*.gohtml index/*.gohtml keys/*.gohtml layout/*.gohtml leader/*.gohtml prompt/*.gohtml tournament/*.gohtml user/*.gohtml
 var templates embed.FS
 
 func Render(e *core.RequestEvent, templ *template.Template, filename string, data any) error {
@@ -0,0 +1,216 @@
+package tournament
+
+import (
+	"aibattle/battler"
+	"aibattle/pages"
+	"aibattle/pages/battle"
+	"aibattle/tournament"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/samber/lo"
+)
+
+type ListData struct {
+	User        *core.Record
+	Tournaments []*core.Record
+	Error       string
+}
+
+type StandingView struct {
+	tournament.Standing
+	Username string
+}
+
+type MatchView struct {
+	ID       string
+	PlayerA  string
+	PlayerB  string
+	Result   string
+	BattleID string
+}
+
+type RoundView struct {
+	Number  int
+	Matches []MatchView
+}
+
+type DetailData struct {
+	User       *core.Record
+	Tournament *core.Record
+	Standings  []StandingView
+	Rounds     []RoundView
+}
+
+func List(app *pocketbase.PocketBase, templ *template.Template) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		return defaultList(e, app, templ, "")
+	}
+}
+
+func defaultList(
+	e *core.RequestEvent, app *pocketbase.PocketBase, templ *template.Template, error string,
+) error {
+	tournaments, err := app.FindRecordsByFilter("tournament", "", "-created", 50, 0)
+	if err != nil {
+		return err
+	}
+	data := &ListData{
+		User:        e.Auth,
+		Tournaments: tournaments,
+		Error:       error,
+	}
+	return pages.Render(e, templ, "tournament/tournament_list.gohtml", data)
+}
+
+func Create(app *pocketbase.PocketBase, templ *template.Template) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		name := e.Request.FormValue("name")
+		if len(name) == 0 || len(name) > 100 {
+			return defaultList(e, app, templ, "Tournament name must be 1-100 characters long")
+		}
+		rounds, _ := strconv.Atoi(e.Request.FormValue("rounds"))
+
+		// superusers are not users
+		record, err := tournament.Create(app, name, e.Request.FormValue("format"), rounds, "")
+		if err != nil {
+			return defaultList(e, app, templ, err.Error())
+		}
+
+		go func() {
+			if err := tournament.Run(app, record.Id); err != nil {
+				log.Printf("Error running tournament %s: %v", record.Id, err)
+			}
+		}()
+
+		return e.Redirect(http.StatusFound, "/tournament/"+record.Id)
+	}
+}
+
+func Detailed(
+	app *pocketbase.PocketBase, templ *template.Template,
+) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		record, err := app.FindRecordById("tournament", e.Request.PathValue("id"))
+		if err != nil {
+			return err
+		}
+
+		matches, err := tournament.LoadMatches(app, record.Id)
+		if err != nil {
+			return err
+		}
+
+		ids := record.GetStringSlice("prompts")
+		userNames, err := getPromptUserNames(app, ids)
+		if err != nil {
+			return err
+		}
+
+		results := lo.FilterMap(
+			matches, func(m *core.Record, _ int) (tournament.MatchResult, bool) {
+				return tournament.ToMatchResult(m)
+			},
+		)
+		standings := lo.Map(
+			tournament.ComputeStandings(ids, results),
+			func(s tournament.Standing, _ int) StandingView {
+				return StandingView{Standing: s, Username: userNames[s.PromptID]}
+			},
+		)
+
+		var rounds []RoundView
+		for _, m := range matches {
+			round := m.GetInt("round")
+			if len(rounds) == 0 || rounds[len(rounds)-1].Number != round {
+				rounds = append(rounds, RoundView{Number: round})
+			}
+			last := &rounds[len(rounds)-1]
+			last.Matches = append(
+				last.Matches, MatchView{
+					ID:       m.Id,
+					PlayerA:  userNames[m.GetString("prompt_a")],
+					PlayerB:  userNames[m.GetString("prompt_b")],
+					Result:   m.GetString("result"),
+					BattleID: m.GetString("battle"),
+				},
+			)
+		}
+
+		data := &DetailData{
+			User:       e.Auth,
+			Tournament: record,
+			Standings:  standings,
+			Rounds:     rounds,
+		}
+		return pages.Render(e, templ, "tournament/tournament.gohtml", data)
+	}
+}
+
+func Match(app *pocketbase.PocketBase, templ *template.Template) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		match, err := app.FindFirstRecordByFilter(
+			"tournament_match", "id = {:id} && tournament = {:tournament}",
+			dbx.Params{
+				"id":         e.Request.PathValue("match"),
+				"tournament": e.Request.PathValue("id"),
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		expErr := app.ExpandRecord(match, []string{"battle"}, nil)
+		if len(expErr) > 0 {
+			return errors.New("could not load battle data")
+		}
+		battleRecord := match.ExpandedOne("battle")
+		if battleRecord == nil {
+			return errors.New("battle not found")
+		}
+
+		userNames, err := getPromptUserNames(app, []string{match.GetString("prompt_b")})
+		if err != nil {
+			return err
+		}
+
+		decompressed, err := battler.LoadBattleJSON(app, battleRecord)
+		if err != nil {
+			return err
+		}
+		data := &battle.DetailView{
+			User:     e.Auth,
+			Battle:   battleRecord,
+			Output:   decompressed,
+			MyTeam:   tournament.ResultTeamA,
+			Opponent: userNames[match.GetString("prompt_b")],
+		}
+		return pages.Render(e, templ, "battle/battle.gohtml", data)
+	}
+}
+
+func getPromptUserNames(app *pocketbase.PocketBase, promptIDs []string) (map[string]string, error) {
+	prompts, err := app.FindRecordsByIds("prompt", promptIDs)
+	if err != nil {
+		return nil, err
+	}
+	expErr := app.ExpandRecords(prompts, []string{"user"}, nil)
+	if len(expErr) > 0 {
+		return nil, lo.Values(expErr)[0]
+	}
+	return lo.SliceToMap(
+		prompts, func(p *core.Record) (string, string) {
+			user := p.ExpandedOne("user")
+			if user == nil {
+				return p.Id, p.Id
+			}
+			return p.Id, user.GetString("name")
+		},
+	), nil
+}
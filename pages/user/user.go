@@ -0,0 +1,271 @@
+package user
+
+import (
+	"aibattle/battler"
+	"aibattle/game/world"
+	"aibattle/pages"
+	"aibattle/season"
+	"fmt"
+	"html/template"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/samber/lo"
+)
+
+// number of latest battles decoded for damage statistics
+const damageBattlesLimit = 50
+
+const (
+	chartWidth  = 600
+	chartHeight = 200
+)
+
+type OpponentStats struct {
+	OpponentID string  `db:"opponent"`
+	Name       string  `db:"name"`
+	Games      int     `db:"games"`
+	Won        int     `db:"won"`
+	Lost       int     `db:"lost"`
+	Draw       int     `db:"draw"`
+	ScoreDiff  float64 `db:"score_diff"`
+}
+
+type PromptStats struct {
+	PromptID  string         `db:"prompt"`
+	Created   types.DateTime `db:"created"`
+	Games     int            `db:"games"`
+	Won       int            `db:"won"`
+	Lost      int            `db:"lost"`
+	Draw      int            `db:"draw"`
+	ScoreDiff float64        `db:"score_diff"`
+}
+
+type DamageStats struct {
+	UnitType string
+	Damage   int
+}
+
+type RatingPoint struct {
+	Date   time.Time
+	Rating float64
+}
+
+type Data struct {
+	User        *core.Record
+	Profile     *core.Record
+	IsOwner     bool
+	Rating      []RatingPoint
+	RatingPath  string
+	MinRating   float64
+	MaxRating   float64
+	Opponents   []OpponentStats
+	Prompts     []PromptStats
+	Damage      []DamageStats
+	DamageGames int
+}
+
+func Profile(app *pocketbase.PocketBase, templ *template.Template) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		profile, err := app.FindRecordById("users", e.Request.PathValue("id"))
+		if err != nil {
+			return e.NotFoundError("user not found", err)
+		}
+
+		rating, err := getRatingHistory(app, profile.Id)
+		if err != nil {
+			return err
+		}
+		opponents, err := getOpponentStats(app, profile.Id)
+		if err != nil {
+			return err
+		}
+		prompts, err := getPromptStats(app, profile.Id)
+		if err != nil {
+			return err
+		}
+		damage, damageGames, err := getDamageStats(app, profile.Id)
+		if err != nil {
+			return err
+		}
+
+		path, minRating, maxRating := getRatingPath(rating)
+		data := &Data{
+			User:        e.Auth,
+			Profile:     profile,
+			IsOwner:     e.Auth != nil && e.Auth.Id == profile.Id,
+			Rating:      rating,
+			RatingPath:  path,
+			MinRating:   minRating,
+			MaxRating:   maxRating,
+			Opponents:   opponents,
+			Prompts:     prompts,
+			Damage:      damage,
+			DamageGames: damageGames,
+		}
+		return pages.Render(e, templ, "user/user.gohtml", data)
+	}
+}
+
+// getRatingHistory replays score changes from the initial score and applies
+// the soft reset at the start of every season.
+func getRatingHistory(app *pocketbase.PocketBase, userID string) ([]RatingPoint, error) {
+	var changes []struct {
+		Created     types.DateTime `db:"created"`
+		ScoreChange float64        `db:"score_change"`
+	}
+	err := app.DB().
+		Select("created", "score_change").
+		From("battle_result").
+		Where(dbx.HashExp{"user": userID, "rated": true}).
+		OrderBy("created ASC").
+		All(&changes)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching score changes: %w", err)
+	}
+
+	seasons, err := app.FindRecordsByFilter("season", "started = true", "start", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	rating := season.InitialScore
+	points := make([]RatingPoint, 0, len(changes))
+	for _, change := range changes {
+		date := change.Created.Time()
+		for len(seasons) > 0 && !seasons[0].GetDateTime("start").Time().After(date) {
+			rating = season.SoftReset(rating)
+			seasons = seasons[1:]
+		}
+		rating += change.ScoreChange
+		points = append(points, RatingPoint{Date: date, Rating: rating})
+	}
+	return points, nil
+}
+
+func getRatingPath(points []RatingPoint) (string, float64, float64) {
+	if len(points) == 0 {
+		return "", 0, 0
+	}
+	ratings := lo.Map(
+		points, func(p RatingPoint, _ int) float64 {
+			return p.Rating
+		},
+	)
+	minRating, maxRating := lo.Min(ratings), lo.Max(ratings)
+	spread := max(maxRating-minRating, 1)
+	step := float64(chartWidth) / float64(max(len(points)-1, 1))
+
+	var path strings.Builder
+	for i, rating := range ratings {
+		x := float64(i) * step
+		y := chartHeight - (rating-minRating)/spread*chartHeight
+		path.WriteString(fmt.Sprintf("%.1f,%.1f ", x, y))
+	}
+	return strings.TrimSpace(path.String()), minRating, maxRating
+}
+
+func getOpponentStats(app *pocketbase.PocketBase, userID string) ([]OpponentStats, error) {
+	var stats []OpponentStats
+	err := app.DB().
+		Select(
+			"battle_result.opponent AS opponent",
+			"COALESCE(users.name, '') AS name",
+			"COUNT(*) AS games",
+			"SUM(battle_result.result = 'won') AS won",
+			"SUM(battle_result.result = 'lost') AS lost",
+			"SUM(battle_result.result = 'draw') AS draw",
+			"SUM(battle_result.score_change) AS score_diff",
+		).
+		From("battle_result").
+		LeftJoin("users", dbx.NewExp("users.id = battle_result.opponent")).
+		Where(dbx.HashExp{"battle_result.user": userID, "battle_result.rated": true}).
+		GroupBy("battle_result.opponent").
+		OrderBy("games DESC").
+		All(&stats)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching opponent stats: %w", err)
+	}
+	return stats, nil
+}
+
+func getPromptStats(app *pocketbase.PocketBase, userID string) ([]PromptStats, error) {
+	var stats []PromptStats
+	err := app.DB().
+		Select(
+			"battle_result.prompt AS prompt",
+			"COALESCE(prompt.created, '') AS created",
+			"COUNT(*) AS games",
+			"SUM(battle_result.result = 'won') AS won",
+			"SUM(battle_result.result = 'lost') AS lost",
+			"SUM(battle_result.result = 'draw') AS draw",
+			"SUM(battle_result.score_change) AS score_diff",
+		).
+		From("battle_result").
+		LeftJoin("prompt", dbx.NewExp("prompt.id = battle_result.prompt")).
+		Where(dbx.HashExp{"battle_result.user": userID, "battle_result.rated": true}).
+		GroupBy("battle_result.prompt").
+		OrderBy("created DESC").
+		All(&stats)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching prompt stats: %w", err)
+	}
+	return stats, nil
+}
+
+func getDamageStats(app *pocketbase.PocketBase, userID string) ([]DamageStats, int, error) {
+	var results []*core.Record
+	err := app.RecordQuery("battle_result").
+		AndWhere(dbx.HashExp{"user": userID, "rated": true}).
+		OrderBy("created DESC").
+		Limit(damageBattlesLimit).
+		All(&results)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error fetching battles: %w", err)
+	}
+	expErr := app.ExpandRecords(results, []string{"battle"}, nil)
+	if len(expErr) > 0 {
+		return nil, 0, lo.Values(expErr)[0]
+	}
+
+	damage := make(map[string]int)
+	games := 0
+	for _, res := range results {
+		battle := res.ExpandedOne("battle")
+		if battle == nil {
+			continue
+		}
+		result, err := battler.LoadBattle(app, battle)
+		if err != nil {
+			log.Printf("Error decoding battle %s: %v", battle.Id, err)
+			continue
+		}
+
+		team := world.TeamA
+		if res.GetString("team") == "teamB" {
+			team = world.TeamB
+		}
+		for unitType, dealt := range result.DamageByUnitType(team) {
+			damage[unitType] += dealt
+		}
+		games++
+	}
+
+	stats := lo.MapToSlice(
+		damage, func(unitType string, dealt int) DamageStats {
+			return DamageStats{UnitType: unitType, Damage: dealt}
+		},
+	)
+	sort.Slice(
+		stats, func(i, j int) bool {
+			return stats[i].Damage > stats[j].Damage
+		},
+	)
+	return stats, games, nil
+}
@@ -0,0 +1,157 @@
+package season
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const InitialScore = 1000.0
+
+// ResetFactor is how much of the distance from the initial score a rating
+// keeps when a new season starts.
+const ResetFactor = 0.5
+
+func SoftReset(score float64) float64 {
+	return math.Round(InitialScore + (score-InitialScore)*ResetFactor)
+}
+
+// Current returns the latest started season or nil when seasons were never
+// used, in which case scores are stored without a season.
+func Current(app core.App) (*core.Record, error) {
+	records, err := app.FindRecordsByFilter(
+		"season", "started = true", "-start", 1, 0,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching current season: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[0], nil
+}
+
+func CurrentID(app core.App) (string, error) {
+	current, err := Current(app)
+	if err != nil || current == nil {
+		return "", err
+	}
+	return current.Id, nil
+}
+
+// FindOrCreateScore returns the user score for the season, a missing score is
+// created from the user's latest score with a soft reset.
+func FindOrCreateScore(app core.App, userID string, seasonID string) (*core.Record, error) {
+	score, err := app.FindFirstRecordByFilter(
+		"score", "user = {:user} && season = {:season}",
+		dbx.Params{"user": userID, "season": seasonID},
+	)
+	if err == nil {
+		return score, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	newScore := InitialScore
+	previous, err := app.FindRecordsByFilter(
+		"score", "user = {:user}", "-created", 1, 0, dbx.Params{"user": userID},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(previous) > 0 {
+		newScore = SoftReset(previous[0].GetFloat("score"))
+	}
+
+	collection, err := app.FindCollectionByNameOrId("score")
+	if err != nil {
+		return nil, err
+	}
+	score = core.NewRecord(collection)
+	score.Set("user", userID)
+	score.Set("season", seasonID)
+	score.Set("score", newScore)
+	if err := app.Save(score); err != nil {
+		return nil, fmt.Errorf("error creating season score: %w", err)
+	}
+	return score, nil
+}
+
+// Start copies every score of the current season into the new one with a
+// soft reset and marks the new season as started.
+func Start(app core.App, season *core.Record) error {
+	previousID, err := CurrentID(app)
+	if err != nil {
+		return err
+	}
+
+	return app.RunInTransaction(
+		func(txApp core.App) error {
+			var scores []*core.Record
+			err := txApp.RecordQuery("score").
+				AndWhere(dbx.HashExp{"season": previousID}).
+				All(&scores)
+			if err != nil {
+				return fmt.Errorf("error fetching previous season scores: %w", err)
+			}
+
+			collection, err := txApp.FindCollectionByNameOrId("score")
+			if err != nil {
+				return err
+			}
+			for _, previous := range scores {
+				score := core.NewRecord(collection)
+				score.Set("user", previous.GetString("user"))
+				score.Set("season", season.Id)
+				score.Set("score", SoftReset(previous.GetFloat("score")))
+				if err := txApp.Save(score); err != nil {
+					return fmt.Errorf("error saving season score: %w", err)
+				}
+			}
+
+			season.Set("started", true)
+			if err := txApp.Save(season); err != nil {
+				return fmt.Errorf("error starting season: %w", err)
+			}
+			log.Printf(
+				"Season %s started, %d scores moved from season '%s'", season.Id, len(scores),
+				previousID,
+			)
+			return nil
+		},
+	)
+}
+
+// RunSeasonTask starts seasons when their start date comes.
+func RunSeasonTask(app core.App) {
+	for {
+		if err := startDueSeasons(app); err != nil {
+			log.Println(err)
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+func startDueSeasons(app core.App) error {
+	seasons, err := app.FindRecordsByFilter(
+		"season", "started = false && start <= {:now}", "start", 0, 0,
+		dbx.Params{"now": types.NowDateTime().String()},
+	)
+	if err != nil {
+		return fmt.Errorf("error fetching seasons to start: %w", err)
+	}
+	for _, s := range seasons {
+		if err := Start(app, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
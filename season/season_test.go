@@ -0,0 +1,153 @@
+package season
+
+import (
+	_ "aibattle/migrations"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	pbtests "github.com/pocketbase/pocketbase/tests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestApp(t *testing.T) *pbtests.TestApp {
+	app, err := pbtests.NewTestApp(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(app.Cleanup)
+	return app
+}
+
+func createRecord(
+	t *testing.T, app core.App, collection string, data map[string]any,
+) *core.Record {
+	c, err := app.FindCollectionByNameOrId(collection)
+	require.NoError(t, err)
+	record := core.NewRecord(c)
+	record.Load(data)
+	require.NoError(t, app.Save(record))
+	return record
+}
+
+func createSeason(t *testing.T, app core.App, name string, start string, started bool) {
+	createRecord(
+		t, app, "season", map[string]any{
+			"name": name, "start": start, "end": start, "started": started,
+		},
+	)
+}
+
+func TestSoftReset(t *testing.T) {
+	tests := []struct {
+		name     string
+		score    float64
+		expected float64
+	}{
+		{name: "initial score", score: InitialScore, expected: InitialScore},
+		{name: "above initial", score: 1200, expected: 1100},
+		{name: "below initial", score: 800, expected: 900},
+		{name: "rounded", score: 1001, expected: 1001},
+		{name: "zero", score: 0, expected: 500},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				assert.Equal(t, test.expected, SoftReset(test.score))
+			},
+		)
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	type season struct {
+		name    string
+		start   string
+		started bool
+	}
+	tests := []struct {
+		name     string
+		seasons  []season
+		expected string
+	}{
+		{name: "no seasons"},
+		{
+			name:    "not started yet",
+			seasons: []season{{"first", "2025-01-01 00:00:00.000Z", false}},
+		},
+		{
+			name: "latest started",
+			seasons: []season{
+				{"second", "2025-06-01 00:00:00.000Z", true},
+				{"first", "2025-01-01 00:00:00.000Z", true},
+			},
+			expected: "second",
+		},
+		{
+			name: "later season not started",
+			seasons: []season{
+				{"first", "2025-01-01 00:00:00.000Z", true},
+				{"second", "2025-06-01 00:00:00.000Z", false},
+			},
+			expected: "first",
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				app := newTestApp(t)
+				for _, s := range test.seasons {
+					createSeason(t, app, s.name, s.start, s.started)
+				}
+				current, err := Current(app)
+				require.NoError(t, err)
+				if test.expected == "" {
+					assert.Nil(t, current)
+					return
+				}
+				require.NotNil(t, current)
+				assert.Equal(t, test.expected, current.GetString("name"))
+			},
+		)
+	}
+}
+
+func TestStart(t *testing.T) {
+	app := newTestApp(t)
+	createSeason(t, app, "first", "2025-01-01 00:00:00.000Z", true)
+	first, err := Current(app)
+	require.NoError(t, err)
+	scores := map[string]float64{"alice": 1200, "bob": 900}
+	users := make(map[string]string)
+	for name, score := range scores {
+		user := createRecord(
+			t, app, "users", map[string]any{
+				"email": name + "@example.com", "password": "password123", "name": name,
+			},
+		)
+		users[name] = user.Id
+		createRecord(
+			t, app, "score", map[string]any{"user": user.Id, "season": first.Id, "score": score},
+		)
+	}
+
+	createSeason(t, app, "second", "2025-06-01 00:00:00.000Z", false)
+	second, err := app.FindFirstRecordByData("season", "name", "second")
+	require.NoError(t, err)
+	require.NoError(t, Start(app, second))
+
+	current, err := Current(app)
+	require.NoError(t, err)
+	assert.Equal(t, second.Id, current.Id)
+	for name, score := range scores {
+		record, err := app.FindFirstRecordByFilter(
+			"score", "user = {:user} && season = {:season}",
+			dbx.Params{"user": users[name], "season": second.Id},
+		)
+		require.NoError(t, err)
+		assert.Equal(t, SoftReset(score), record.GetFloat("score"), name)
+	}
+	// the previous season keeps its scores
+	record, err := FindOrCreateScore(app, users["alice"], first.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 1200.0, record.GetFloat("score"))
+}
@@ -0,0 +1,136 @@
+package tournament
+
+import (
+	"slices"
+
+	"github.com/samber/lo"
+)
+
+const (
+	FormatRoundRobin = "round_robin"
+	FormatSwiss      = "swiss"
+)
+
+// Pairing is a single game of a round. Empty B means A gets a bye.
+type Pairing struct {
+	A string
+	B string
+}
+
+func (p Pairing) IsBye() bool {
+	return p.B == ""
+}
+
+// RoundRobin builds all rounds with the circle method, so every prompt meets
+// every other prompt exactly once.
+func RoundRobin(ids []string) [][]Pairing {
+	if len(ids) < 2 {
+		return nil
+	}
+	players := slices.Clone(ids)
+	if len(players)%2 == 1 {
+		players = append(players, "")
+	}
+	n := len(players)
+
+	rounds := make([][]Pairing, 0, n-1)
+	for round := range n - 1 {
+		pairings := make([]Pairing, 0, n/2)
+		for i := range n / 2 {
+			a, b := players[i], players[n-1-i]
+			// alternate sides so the same prompt isn't always team A
+			if (round+i)%2 == 1 {
+				a, b = b, a
+			}
+			if a == "" {
+				a, b = b, a
+			}
+			pairings = append(pairings, Pairing{A: a, B: b})
+		}
+		rounds = append(rounds, pairings)
+
+		// keep the first player fixed and rotate the rest
+		last := players[n-1]
+		copy(players[2:], players[1:n-1])
+		players[1] = last
+	}
+	return rounds
+}
+
+// SwissPairings pairs players with similar points for the next round.
+// Standings must be sorted, rematches are avoided when possible and the bye
+// goes to the lowest ranked player who hasn't had one yet.
+func SwissPairings(standings []Standing, results []MatchResult) []Pairing {
+	played := make(map[string]map[string]bool)
+	hadBye := make(map[string]bool)
+	for _, res := range results {
+		if res.IsBye() {
+			hadBye[res.A] = true
+			continue
+		}
+		if played[res.A] == nil {
+			played[res.A] = make(map[string]bool)
+		}
+		if played[res.B] == nil {
+			played[res.B] = make(map[string]bool)
+		}
+		played[res.A][res.B] = true
+		played[res.B][res.A] = true
+	}
+
+	ids := lo.Map(
+		standings, func(s Standing, _ int) string {
+			return s.PromptID
+		},
+	)
+
+	var pairings []Pairing
+	if len(ids)%2 == 1 {
+		byeIndex := len(ids) - 1
+		for i := len(ids) - 1; i >= 0; i-- {
+			if !hadBye[ids[i]] {
+				byeIndex = i
+				break
+			}
+		}
+		pairings = append(pairings, Pairing{A: ids[byeIndex]})
+		ids = slices.Delete(ids, byeIndex, byeIndex+1)
+	}
+
+	paired := make(map[string]bool)
+	for i, a := range ids {
+		if paired[a] {
+			continue
+		}
+		opponent := ""
+		for _, b := range ids[i+1:] {
+			if paired[b] {
+				continue
+			}
+			if opponent == "" {
+				// fallback to a rematch if everybody else was already played
+				opponent = b
+			}
+			if !played[a][b] {
+				opponent = b
+				break
+			}
+		}
+		if opponent == "" {
+			continue
+		}
+		paired[a] = true
+		paired[opponent] = true
+		pairings = append(pairings, Pairing{A: a, B: opponent})
+	}
+	return pairings
+}
+
+// SwissRounds is the default number of rounds needed to find a single winner.
+func SwissRounds(players int) int {
+	rounds := 0
+	for n := 1; n < players; n *= 2 {
+		rounds++
+	}
+	return rounds
+}
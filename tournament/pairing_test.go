@@ -0,0 +1,96 @@
+package tournament
+
+import (
+	"aibattle/game/world"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundRobin(t *testing.T) {
+	ids := []string{"a", "b", "c", "d", "e"}
+	rounds := RoundRobin(ids)
+	assert.Len(t, rounds, 5)
+
+	met := make(map[[2]string]int)
+	byes := make(map[string]int)
+	for _, round := range rounds {
+		seen := make(map[string]bool)
+		for _, p := range round {
+			assert.False(t, seen[p.A])
+			seen[p.A] = true
+			if p.IsBye() {
+				byes[p.A]++
+				continue
+			}
+			assert.False(t, seen[p.B])
+			seen[p.B] = true
+			key := [2]string{min(p.A, p.B), max(p.A, p.B)}
+			met[key]++
+		}
+		assert.Len(t, seen, len(ids))
+	}
+
+	// every pair meets exactly once and everybody gets one bye
+	assert.Len(t, met, 10)
+	for _, count := range met {
+		assert.Equal(t, 1, count)
+	}
+	for _, id := range ids {
+		assert.Equal(t, 1, byes[id])
+	}
+
+	assert.Nil(t, RoundRobin([]string{"a"}))
+}
+
+func TestSwissPairings(t *testing.T) {
+	ids := []string{"a", "b", "c", "d", "e"}
+	results := []MatchResult{
+		{Round: 1, A: "a", B: "b", Winner: world.TeamA},
+		{Round: 1, A: "c", B: "d", Winner: world.TeamA},
+		{Round: 1, A: "e"},
+	}
+	standings := ComputeStandings(ids, results)
+	pairings := SwissPairings(standings, results)
+	assert.Len(t, pairings, 3)
+
+	// e already had a bye, so the lowest ranked player without one gets it
+	bye := pairings[0]
+	assert.True(t, bye.IsBye())
+	assert.NotEqual(t, "e", bye.A)
+
+	for _, p := range pairings[1:] {
+		assert.False(t, p.IsBye())
+		assert.NotEqual(t, [2]string{"a", "b"}, [2]string{min(p.A, p.B), max(p.A, p.B)})
+		assert.NotEqual(t, [2]string{"c", "d"}, [2]string{min(p.A, p.B), max(p.A, p.B)})
+	}
+}
+
+func TestComputeStandings(t *testing.T) {
+	ids := []string{"a", "b", "c", "d"}
+	results := []MatchResult{
+		{Round: 1, A: "a", B: "b", Winner: world.TeamA},
+		{Round: 1, A: "c", B: "d", Winner: world.TeamB},
+		{Round: 2, A: "a", B: "d", Winner: world.Draw},
+		{Round: 2, A: "b", B: "c", Winner: world.TeamA},
+	}
+	standings := ComputeStandings(ids, results)
+
+	// a and d have equal points, but a played the stronger opponents
+	assert.Equal(t, "a", standings[0].PromptID)
+	assert.Equal(t, 1.5, standings[0].Points)
+	assert.Equal(t, 2.5, standings[0].Buchholz)
+	assert.Equal(t, 1.75, standings[0].SonnebornBerger)
+	assert.Equal(t, "d", standings[1].PromptID)
+	assert.Equal(t, 1.5, standings[1].Points)
+	assert.Equal(t, 1.5, standings[1].Buchholz)
+	assert.Equal(t, 0.75, standings[1].SonnebornBerger)
+	assert.Equal(t, "c", standings[3].PromptID)
+}
+
+func TestSwissRounds(t *testing.T) {
+	assert.Equal(t, 0, SwissRounds(1))
+	assert.Equal(t, 1, SwissRounds(2))
+	assert.Equal(t, 3, SwissRounds(5))
+	assert.Equal(t, 3, SwissRounds(8))
+}
@@ -0,0 +1,111 @@
+package tournament
+
+import (
+	"aibattle/game/world"
+	"cmp"
+	"slices"
+)
+
+type MatchResult struct {
+	Round  int
+	A      string
+	B      string
+	Winner int
+}
+
+func (r MatchResult) IsBye() bool {
+	return r.B == ""
+}
+
+type Standing struct {
+	PromptID        string
+	Played          int
+	Wins            int
+	Draws           int
+	Losses          int
+	Points          float64
+	Buchholz        float64
+	SonnebornBerger float64
+}
+
+// ComputeStandings scores a win as 1 point and a draw as 0.5, a bye counts as a
+// win. Ties are broken by Buchholz (sum of opponents' points), then by
+// Sonneborn-Berger (points of beaten opponents plus half of drawn ones), then
+// by number of wins.
+func ComputeStandings(ids []string, results []MatchResult) []Standing {
+	byID := make(map[string]*Standing, len(ids))
+	for _, id := range ids {
+		byID[id] = &Standing{PromptID: id}
+	}
+
+	for _, res := range results {
+		a, b := byID[res.A], byID[res.B]
+		if a == nil {
+			continue
+		}
+		if res.IsBye() {
+			a.Played++
+			a.Wins++
+			a.Points++
+			continue
+		}
+		if b == nil {
+			continue
+		}
+		a.Played++
+		b.Played++
+		switch res.Winner {
+		case world.TeamA:
+			a.Wins++
+			a.Points++
+			b.Losses++
+		case world.TeamB:
+			b.Wins++
+			b.Points++
+			a.Losses++
+		default:
+			a.Draws++
+			b.Draws++
+			a.Points += 0.5
+			b.Points += 0.5
+		}
+	}
+
+	for _, res := range results {
+		if res.IsBye() {
+			continue
+		}
+		a, b := byID[res.A], byID[res.B]
+		if a == nil || b == nil {
+			continue
+		}
+		a.Buchholz += b.Points
+		b.Buchholz += a.Points
+		switch res.Winner {
+		case world.TeamA:
+			a.SonnebornBerger += b.Points
+		case world.TeamB:
+			b.SonnebornBerger += a.Points
+		default:
+			a.SonnebornBerger += b.Points / 2
+			b.SonnebornBerger += a.Points / 2
+		}
+	}
+
+	standings := make([]Standing, 0, len(ids))
+	for _, id := range ids {
+		standings = append(standings, *byID[id])
+	}
+	slices.SortStableFunc(
+		standings, func(x, y Standing) int {
+			return cmp.Or(
+				cmp.Compare(y.Points, x.Points),
+				cmp.Compare(y.Buchholz, x.Buchholz),
+				cmp.Compare(y.SonnebornBerger, x.SonnebornBerger),
+				cmp.Compare(y.Wins, x.Wins),
+				cmp.Compare(x.PromptID, y.PromptID),
+			)
+		},
+	)
+	return standings
+}
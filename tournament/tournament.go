@@ -0,0 +1,264 @@
+package tournament
+
+import (
+	"aibattle/battler"
+	"aibattle/game/world"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/samber/lo"
+)
+
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusError   = "error"
+)
+
+const (
+	ResultTeamA = "teamA"
+	ResultTeamB = "teamB"
+	ResultDraw  = "draw"
+	ResultBye   = "bye"
+	ResultError = "error"
+)
+
+// FailInterrupted marks tournaments left pending or running by a stopped
+// server as failed, they would block new tournaments forever. Tournaments run
+// inside the server process, so it must be called before any is started.
+func FailInterrupted(app core.App) error {
+	records, err := app.FindRecordsByFilter(
+		"tournament", "status = {:pending} || status = {:running}", "", 0, 0,
+		dbx.Params{"pending": StatusPending, "running": StatusRunning},
+	)
+	if err != nil {
+		return fmt.Errorf("error fetching interrupted tournaments: %w", err)
+	}
+	for _, record := range records {
+		log.Printf("Tournament %s was interrupted", record.Id)
+		record.Set("status", StatusError)
+		record.Set("error", "the tournament was interrupted by a server restart")
+		if err := app.Save(record); err != nil {
+			return fmt.Errorf("error updating tournament status: %w", err)
+		}
+	}
+	return nil
+}
+
+// Create snapshots the currently active prompts into a new pending
+// tournament, userID is empty for tournaments started by a superuser.
+func Create(
+	app *pocketbase.PocketBase, name string, format string, rounds int, userID string,
+) (*core.Record, error) {
+	if format != FormatRoundRobin && format != FormatSwiss {
+		return nil, fmt.Errorf("unknown tournament format %s", format)
+	}
+
+	running, err := app.FindRecordsByFilter(
+		"tournament", "status = {:pending} || status = {:running}", "", 1, 0,
+		dbx.Params{"pending": StatusPending, "running": StatusRunning},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error checking running tournaments: %w", err)
+	}
+	if len(running) > 0 {
+		return nil, errors.New("another tournament is already running, please wait until it is finished")
+	}
+
+	var prompts []*core.Record
+	err = app.RecordQuery("prompt").
+		AndWhere(dbx.HashExp{"active": true, "status": "done"}).
+		OrderBy("created ASC").
+		All(&prompts)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching active prompts: %w", err)
+	}
+	if len(prompts) < 2 {
+		return nil, errors.New("not enough active prompts for a tournament")
+	}
+
+	switch format {
+	case FormatRoundRobin:
+		rounds = len(RoundRobin(lo.Map(prompts, getID)))
+	case FormatSwiss:
+		if rounds <= 0 {
+			rounds = SwissRounds(len(prompts))
+		}
+	}
+
+	collection, err := app.FindCollectionByNameOrId("tournament")
+	if err != nil {
+		return nil, fmt.Errorf("error finding tournament collection: %w", err)
+	}
+	record := core.NewRecord(collection)
+	record.Set("name", name)
+	record.Set("format", format)
+	record.Set("rounds", rounds)
+	record.Set("status", StatusPending)
+	record.Set("prompts", lo.Map(prompts, getID))
+	record.Set("created_by", userID)
+	if err := app.Save(record); err != nil {
+		return nil, fmt.Errorf("error saving tournament: %w", err)
+	}
+	return record, nil
+}
+
+// Run plays every round of the tournament and stores each game as a
+// tournament_match. Tournament games don't change user scores.
+func Run(app *pocketbase.PocketBase, tournamentID string) error {
+	record, err := app.FindRecordById("tournament", tournamentID)
+	if err != nil {
+		return err
+	}
+	record.Set("status", StatusRunning)
+	if err := app.Save(record); err != nil {
+		return fmt.Errorf("error updating tournament status: %w", err)
+	}
+
+	runErr := runRounds(app, record)
+	if runErr != nil {
+		record.Set("status", StatusError)
+		record.Set("error", runErr.Error())
+	} else {
+		record.Set("status", StatusDone)
+	}
+	if err := app.Save(record); err != nil {
+		return fmt.Errorf("error updating tournament status: %w", err)
+	}
+	return runErr
+}
+
+func runRounds(app *pocketbase.PocketBase, record *core.Record) error {
+	ids := record.GetStringSlice("prompts")
+	prompts, err := app.FindRecordsByIds("prompt", ids)
+	if err != nil {
+		return fmt.Errorf("error fetching tournament prompts: %w", err)
+	}
+	promptByID := lo.KeyBy(
+		prompts, func(p *core.Record) string {
+			return p.Id
+		},
+	)
+
+	matchColl, err := app.FindCollectionByNameOrId("tournament_match")
+	if err != nil {
+		return fmt.Errorf("error finding tournament_match collection: %w", err)
+	}
+
+	var roundRobin [][]Pairing
+	if record.GetString("format") == FormatRoundRobin {
+		roundRobin = RoundRobin(ids)
+	}
+
+	var results []MatchResult
+	for round := 1; round <= record.GetInt("rounds"); round++ {
+		var pairings []Pairing
+		if roundRobin != nil {
+			pairings = roundRobin[round-1]
+		} else {
+			pairings = SwissPairings(ComputeStandings(ids, results), results)
+		}
+
+		for _, pairing := range pairings {
+			match := core.NewRecord(matchColl)
+			match.Set("tournament", record.Id)
+			match.Set("round", round)
+			match.Set("prompt_a", pairing.A)
+			match.Set("prompt_b", pairing.B)
+
+			if pairing.IsBye() {
+				match.Set("result", ResultBye)
+			} else {
+				battle, winner, playErr := playMatch(
+					app, promptByID[pairing.A], promptByID[pairing.B],
+				)
+				if playErr != nil {
+					log.Printf("tournament %s match error: %v", record.Id, playErr)
+					match.Set("result", ResultError)
+				} else {
+					match.Set("battle", battle.Id)
+					match.Set("result", winnerToResult(winner))
+				}
+			}
+			if err := app.Save(match); err != nil {
+				return fmt.Errorf("error saving tournament match: %w", err)
+			}
+
+			if res, ok := ToMatchResult(match); ok {
+				results = append(results, res)
+			}
+		}
+	}
+	return nil
+}
+
+func playMatch(
+	app *pocketbase.PocketBase, promptA *core.Record, promptB *core.Record,
+) (*core.Record, int, error) {
+	if promptA == nil || promptB == nil {
+		return nil, 0, errors.New("prompt not found")
+	}
+	result, err := battler.GetBattleResult(context.Background(), promptA, promptB)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error running battle: %w", err)
+	}
+	battle, err := battler.SaveBattle(app, result, promptA, promptB)
+	if err != nil {
+		return nil, 0, err
+	}
+	return battle, result.Winner, nil
+}
+
+// LoadMatches returns all matches of the tournament ordered by round.
+func LoadMatches(app *pocketbase.PocketBase, tournamentID string) ([]*core.Record, error) {
+	var matches []*core.Record
+	err := app.RecordQuery("tournament_match").
+		AndWhere(dbx.HashExp{"tournament": tournamentID}).
+		OrderBy("round ASC", "created ASC").
+		All(&matches)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching tournament matches: %w", err)
+	}
+	return matches, nil
+}
+
+// ToMatchResult converts a stored match, failed games are not counted.
+func ToMatchResult(match *core.Record) (MatchResult, bool) {
+	res := MatchResult{
+		Round: match.GetInt("round"),
+		A:     match.GetString("prompt_a"),
+		B:     match.GetString("prompt_b"),
+	}
+	switch match.GetString("result") {
+	case ResultTeamA, ResultBye:
+		res.Winner = world.TeamA
+	case ResultTeamB:
+		res.Winner = world.TeamB
+	case ResultDraw:
+		res.Winner = world.Draw
+	default:
+		return res, false
+	}
+	return res, true
+}
+
+func winnerToResult(winner int) string {
+	switch winner {
+	case world.TeamA:
+		return ResultTeamA
+	case world.TeamB:
+		return ResultTeamB
+	default:
+		return ResultDraw
+	}
+}
+
+func getID(r *core.Record, _ int) string {
+	return r.Id
+}
@@ -0,0 +1,178 @@
+package usage
+
+import (
+	"aibattle/pages/builder"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	defaultDailyQuota   = 500_000
+	defaultMonthlyQuota = 5_000_000
+)
+
+// ReservedTokens are counted for every generation waiting in the queue, its
+// usage is only recorded when it finishes.
+const ReservedTokens = 20_000
+
+// Quotas limit the tokens a user can spend on prompt generation, zero
+// disables the limit.
+type Quotas struct {
+	Daily   int
+	Monthly int
+}
+
+// Limits are the quotas of prompt generation, main reads them from the
+// environment at startup.
+var Limits = Quotas{Daily: defaultDailyQuota, Monthly: defaultMonthlyQuota}
+
+// QuotasFromEnv reads DAILY_TOKEN_QUOTA and MONTHLY_TOKEN_QUOTA.
+func QuotasFromEnv() (Quotas, error) {
+	quotas := Quotas{Daily: defaultDailyQuota, Monthly: defaultMonthlyQuota}
+	for name, quota := range map[string]*int{
+		"DAILY_TOKEN_QUOTA":   &quotas.Daily,
+		"MONTHLY_TOKEN_QUOTA": &quotas.Monthly,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return quotas, fmt.Errorf("%s must be a non-negative number", name)
+		}
+		*quota = number
+	}
+	return quotas, nil
+}
+
+// Record stores the tokens used by one generation of the prompt.
+func Record(
+	app core.App, prompt *core.Record, model builder.ModelOption, tokens builder.Usage,
+) error {
+	collection, err := app.FindCollectionByNameOrId("usage")
+	if err != nil {
+		return err
+	}
+	record := core.NewRecord(collection)
+	record.Set("user", prompt.GetString("user"))
+	record.Set("prompt", prompt.Id)
+	record.Set("model", model.ID)
+	record.Set("input_tokens", tokens.InputTokens)
+	record.Set("output_tokens", tokens.OutputTokens)
+	record.Set("cost", model.Cost(tokens))
+	return app.Save(record)
+}
+
+// Tokens returns the number of tokens the user spent since the time.
+func Tokens(app core.App, userID string, since time.Time) (int, error) {
+	var total int
+	err := app.DB().
+		Select("COALESCE(SUM(input_tokens + output_tokens), 0)").
+		From("usage").
+		Where(dbx.HashExp{"user": userID}).
+		AndWhere(dbx.NewExp("created >= {:since}", dbx.Params{"since": dateString(since)})).
+		Row(&total)
+	return total, err
+}
+
+// Queued returns the number of the user's prompts waiting for generation.
+func Queued(app core.App, userID string) (int, error) {
+	count, err := app.CountRecords(
+		"prompt", dbx.HashExp{"user": userID, "status": ""}, dbx.Not(dbx.HashExp{"kind": "code"}),
+	)
+	return int(count), err
+}
+
+// CheckQuotas returns an error describing the exceeded quota, days and
+// months start in UTC. Queued generations count as ReservedTokens each.
+func CheckQuotas(app core.App, userID string, quotas Quotas, now time.Time) error {
+	queued, err := Queued(app, userID)
+	if err != nil {
+		return err
+	}
+	return checkTokens(
+		quotas, now, queued*ReservedTokens, func(since time.Time) (int, error) {
+			return Tokens(app, userID, since)
+		},
+	)
+}
+
+func checkTokens(
+	quotas Quotas, now time.Time, reserved int, tokens func(since time.Time) (int, error),
+) error {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for _, quota := range []struct {
+		limit int
+		since time.Time
+		name  string
+	}{
+		{quotas.Daily, day, "daily"},
+		{quotas.Monthly, month, "monthly"},
+	} {
+		if quota.limit == 0 {
+			continue
+		}
+		used, err := tokens(quota.since)
+		if err != nil {
+			return err
+		}
+		if used+reserved >= quota.limit {
+			return fmt.Errorf(
+				"You have used your %s quota of %d tokens, please try later.", quota.name,
+				quota.limit,
+			)
+		}
+	}
+	return nil
+}
+
+// ReportEntry sums the usage of one user.
+type ReportEntry struct {
+	User         string  `json:"user" db:"user"`
+	Username     string  `json:"username" db:"username"`
+	Generations  int     `json:"generations" db:"generations"`
+	InputTokens  int     `json:"inputTokens" db:"input_tokens"`
+	OutputTokens int     `json:"outputTokens" db:"output_tokens"`
+	Cost         float64 `json:"cost" db:"cost"`
+}
+
+// Report returns the usage per user in the period, the most expensive users
+// first. Zero times leave the period open.
+func Report(app core.App, since time.Time, until time.Time) ([]ReportEntry, error) {
+	query := app.DB().
+		Select(
+			"usage.user AS user",
+			"COALESCE(users.name, '') AS username",
+			"COUNT(*) AS generations",
+			"SUM(usage.input_tokens) AS input_tokens",
+			"SUM(usage.output_tokens) AS output_tokens",
+			"SUM(usage.cost) AS cost",
+		).
+		From("usage").
+		LeftJoin("users", dbx.NewExp("users.id = usage.user")).
+		GroupBy("usage.user").
+		OrderBy("SUM(usage.cost) DESC", "SUM(usage.input_tokens + usage.output_tokens) DESC")
+	if !since.IsZero() {
+		query.AndWhere(dbx.NewExp("usage.created >= {:since}", dbx.Params{"since": dateString(since)}))
+	}
+	if !until.IsZero() {
+		query.AndWhere(dbx.NewExp("usage.created < {:until}", dbx.Params{"until": dateString(until)}))
+	}
+	entries := []ReportEntry{}
+	err := query.All(&entries)
+	return entries, err
+}
+
+func dateString(t time.Time) string {
+	date, _ := types.ParseDateTime(t)
+	return date.String()
+}
@@ -0,0 +1,185 @@
+package usage
+
+import (
+	"aibattle/pages/builder"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCost(t *testing.T) {
+	tests := []struct {
+		name  string
+		model builder.ModelOption
+		usage builder.Usage
+		cost  float64
+	}{
+		{
+			name:  "unknown price",
+			model: builder.ModelOption{},
+			usage: builder.Usage{InputTokens: 1000, OutputTokens: 1000},
+			cost:  0,
+		},
+		{
+			name:  "input and output prices",
+			model: builder.ModelOption{InputPrice: 3, OutputPrice: 15},
+			usage: builder.Usage{InputTokens: 1_000_000, OutputTokens: 200_000},
+			cost:  6,
+		},
+		{
+			name:  "no tokens",
+			model: builder.ModelOption{InputPrice: 3, OutputPrice: 15},
+			cost:  0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				assert.InDelta(t, test.cost, test.model.Cost(test.usage), 1e-9)
+			},
+		)
+	}
+}
+
+func TestQuotasFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		daily   string
+		monthly string
+		quotas  Quotas
+		err     bool
+	}{
+		{
+			name:   "defaults",
+			quotas: Quotas{Daily: defaultDailyQuota, Monthly: defaultMonthlyQuota},
+		},
+		{
+			name:    "both set",
+			daily:   "1000",
+			monthly: "20000",
+			quotas:  Quotas{Daily: 1000, Monthly: 20000},
+		},
+		{
+			name:   "zero disables",
+			daily:  "0",
+			quotas: Quotas{Daily: 0, Monthly: defaultMonthlyQuota},
+		},
+		{name: "not a number", daily: "lots", err: true},
+		{name: "negative", monthly: "-1", err: true},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				t.Setenv("DAILY_TOKEN_QUOTA", test.daily)
+				t.Setenv("MONTHLY_TOKEN_QUOTA", test.monthly)
+				quotas, err := QuotasFromEnv()
+				if test.err {
+					assert.Error(t, err)
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, test.quotas, quotas)
+			},
+		)
+	}
+}
+
+func TestCheckTokens(t *testing.T) {
+	east := time.FixedZone("UTC+3", 3*60*60)
+	quotas := Quotas{Daily: 100, Monthly: 1000}
+	tests := []struct {
+		name     string
+		quotas   Quotas
+		now      time.Time
+		reserved int
+		// tokens used since the start of the period
+		used map[time.Time]int
+		err  string
+	}{
+		{
+			name:   "under both quotas",
+			quotas: quotas,
+			now:    time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC),
+			used: map[time.Time]int{
+				time.Date(2025, 6, 15, 0, 0, 0, 0, time.UTC): 99,
+				time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC):  999,
+			},
+		},
+		{
+			name:   "daily quota",
+			quotas: quotas,
+			now:    time.Date(2025, 6, 15, 23, 59, 0, 0, time.UTC),
+			used: map[time.Time]int{
+				time.Date(2025, 6, 15, 0, 0, 0, 0, time.UTC): 100,
+				time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC):  100,
+			},
+			err: "daily",
+		},
+		{
+			name:   "monthly quota",
+			quotas: quotas,
+			now:    time.Date(2025, 6, 30, 8, 0, 0, 0, time.UTC),
+			used: map[time.Time]int{
+				time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC): 0,
+				time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC):  1000,
+			},
+			err: "monthly",
+		},
+		{
+			name:   "first day of the month",
+			quotas: quotas,
+			now:    time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC),
+			used: map[time.Time]int{
+				time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC): 0,
+			},
+		},
+		{
+			// 01:30 in UTC+3 is still the last day of June in UTC
+			name:   "periods start in UTC",
+			quotas: quotas,
+			now:    time.Date(2025, 7, 1, 1, 30, 0, 0, east),
+			used: map[time.Time]int{
+				time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC): 10,
+				time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC):  1000,
+			},
+			err: "monthly",
+		},
+		{
+			name:     "queued generations",
+			quotas:   quotas,
+			now:      time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC),
+			reserved: 60,
+			used: map[time.Time]int{
+				time.Date(2025, 6, 15, 0, 0, 0, 0, time.UTC): 40,
+				time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC):  40,
+			},
+			err: "daily",
+		},
+		{
+			name:   "disabled quotas",
+			quotas: Quotas{},
+			now:    time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.name, func(t *testing.T) {
+				err := checkTokens(
+					test.quotas, test.now, test.reserved, func(since time.Time) (int, error) {
+						used, ok := test.used[since]
+						require.True(t, ok, "unexpected period start %s", since)
+						return used, nil
+					},
+				)
+				if test.err == "" {
+					assert.NoError(t, err)
+					return
+				}
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.err)
+			},
+		)
+	}
+}